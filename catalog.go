@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+// internalSchemas are the built-in schemas sqlc seeds its catalog with.
+var internalSchemas = map[string]bool{
+	"pg_catalog":         true,
+	"pg_temp":            true,
+	"information_schema": true,
+}
+
+// schemaFromCatalog converts the catalog sqlc built from the schema files into
+// the diagram model. The catalog only carries tables, columns, enums and
+// composite type names, so keys, foreign keys, check constraints, views and
+// domains can't be recovered from it.
+func schemaFromCatalog(c *pb.Catalog, engine string) *Schema {
+	s := newSchema(engine)
+
+	for _, cs := range c.GetSchemas() {
+		if internalSchemas[cs.GetName()] {
+			continue
+		}
+		sch := catalogSchema(c, cs.GetName())
+
+		for _, ct := range cs.GetTables() {
+			tn := ct.GetRel().GetName()
+			if tn == "" {
+				continue
+			}
+			t := ensureTable(s.Tables, catalogSchema(c, ct.GetRel().GetSchema(), sch), tn)
+			for _, col := range ct.GetColumns() {
+				t.Cols = upsertCol(t.Cols, Column{
+					Name:    col.GetName(),
+					Type:    catalogType(c, col),
+					NotNull: col.GetNotNull(),
+				})
+			}
+		}
+
+		for _, e := range cs.GetEnums() {
+			s.Types[key(sch, e.GetName())] = &CustomType{
+				Schema:   sch,
+				Name:     e.GetName(),
+				TypeKind: "enum",
+				Values:   e.GetVals(),
+			}
+		}
+
+		for _, ct := range cs.GetCompositeTypes() {
+			s.Types[key(sch, ct.GetName())] = &CustomType{
+				Schema:   sch,
+				Name:     ct.GetName(),
+				TypeKind: "composite",
+			}
+		}
+	}
+
+	return s
+}
+
+// catalogSchema returns the first non-empty schema name, mapping the
+// catalog's default schema to "" the same way unqualified names are keyed
+// when parsing migrations.
+func catalogSchema(c *pb.Catalog, names ...string) string {
+	for _, n := range names {
+		if n == "" {
+			continue
+		}
+		if n == c.GetDefaultSchema() {
+			return ""
+		}
+		return n
+	}
+	return ""
+}
+
+// catalogType formats a column's type. Built-in types live in pg_catalog,
+// which is left off like the default schema so they read the same as when
+// parsing migrations.
+func catalogType(c *pb.Catalog, col *pb.Column) string {
+	t := col.GetType().GetName()
+	if sch := col.GetType().GetSchema(); sch != "" && sch != "pg_catalog" && sch != c.GetDefaultSchema() {
+		t = sch + "." + t
+	}
+	if col.GetLength() > 0 {
+		t += fmt.Sprintf("(%d)", col.GetLength())
+	}
+	dims := int(col.GetArrayDims())
+	if dims == 0 && col.GetIsArray() {
+		dims = 1
+	}
+	return t + strings.Repeat("[]", dims)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+func testCatalog() *pb.Catalog {
+	return &pb.Catalog{
+		DefaultSchema: "public",
+		Schemas: []*pb.Schema{
+			{
+				Name: "pg_catalog",
+				Tables: []*pb.Table{
+					{Rel: &pb.Identifier{Schema: "pg_catalog", Name: "pg_class"}},
+				},
+			},
+			{
+				Name: "public",
+				Tables: []*pb.Table{{
+					Rel: &pb.Identifier{Name: "users"},
+					Columns: []*pb.Column{
+						{Name: "id", NotNull: true, Type: &pb.Identifier{Schema: "pg_catalog", Name: "int8"}},
+						{Name: "name", Type: &pb.Identifier{Name: "varchar"}, Length: 40},
+						{Name: "tags", IsArray: true, Type: &pb.Identifier{Name: "text"}},
+						{Name: "grid", ArrayDims: 2, Type: &pb.Identifier{Name: "int4"}},
+						{Name: "mood", Type: &pb.Identifier{Schema: "public", Name: "mood"}},
+					},
+				}},
+				Enums:          []*pb.Enum{{Name: "mood", Vals: []string{"sad", "ok", "happy"}}},
+				CompositeTypes: []*pb.CompositeType{{Name: "address"}},
+			},
+			{
+				Name: "audit",
+				Tables: []*pb.Table{{
+					Rel: &pb.Identifier{Schema: "audit", Name: "events"},
+					Columns: []*pb.Column{
+						{Name: "kind", Type: &pb.Identifier{Schema: "audit", Name: "kind"}},
+					},
+				}},
+			},
+		},
+	}
+}
+
+func TestSchemaFromCatalog(t *testing.T) {
+	s := schemaFromCatalog(testCatalog(), "postgresql")
+
+	if got, want := sortedKeys(s.Tables), []string{"audit.events", "users"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tables %v, want %v", got, want)
+	}
+	wantCols := []Column{
+		{Name: "id", Type: "int8", NotNull: true},
+		{Name: "name", Type: "varchar(40)"},
+		{Name: "tags", Type: "text[]"},
+		{Name: "grid", Type: "int4[][]"},
+		{Name: "mood", Type: "mood"},
+	}
+	if got := s.Tables["users"].Cols; !reflect.DeepEqual(got, wantCols) {
+		t.Errorf("users columns\ngot:  %+v\nwant: %+v", got, wantCols)
+	}
+	if got := s.Tables["audit.events"].Cols[0].Type; got != "audit.kind" {
+		t.Errorf("audit.events.kind type %q, want audit.kind", got)
+	}
+
+	if got, want := sortedKeys(s.Types), []string{"address", "mood"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("types %v, want %v", got, want)
+	}
+	if e := s.Types["mood"]; e.TypeKind != "enum" || !reflect.DeepEqual(e.Values, []string{"sad", "ok", "happy"}) {
+		t.Errorf("mood is %+v", e)
+	}
+	if c := s.Types["address"]; c.TypeKind != "composite" {
+		t.Errorf("address is %+v", c)
+	}
+}
+
+func TestPluginSchemaInput(t *testing.T) {
+	withFiles := &pb.GenerateRequest{
+		Settings: &pb.Settings{Engine: "postgresql", Schema: []string{"testdata/migrations"}},
+		Catalog:  testCatalog(),
+	}
+	noFiles := &pb.GenerateRequest{
+		Settings: &pb.Settings{Engine: "postgresql", Schema: []string{"testdata/missing"}},
+		Catalog:  testCatalog(),
+	}
+	tests := []struct {
+		name    string
+		gr      *pb.GenerateRequest
+		input   string
+		until   string
+		catalog bool // whether the schema came from the catalog
+		wantErr bool
+	}{
+		{name: "auto reads the files", gr: withFiles, input: inputAuto},
+		{name: "auto falls back to the catalog", gr: noFiles, input: inputAuto, catalog: true},
+		{name: "catalog ignores the files", gr: withFiles, input: inputCatalog, catalog: true},
+		{name: "files needs the files", gr: noFiles, input: inputFiles, wantErr: true},
+		{name: "until needs the files", gr: noFiles, input: inputAuto, until: "3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := defaultOptions()
+			opts.Input, opts.Until = tt.input, tt.until
+			s, err := pluginSchema(tt.gr, opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// only the catalog has audit.events
+			_, fromCatalog := s.Tables["audit.events"]
+			if fromCatalog != tt.catalog {
+				t.Errorf("got the catalog %v, want %v (tables %v)", fromCatalog, tt.catalog, sortedKeys(s.Tables))
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// changelogMarker starts the changelog so CI can find the comment it posted
+// last time and edit it instead of posting another.
+const changelogMarker = "<!-- sqlc-viz-plugin:schema-changes -->"
+
+// renderChangelog writes the diff as a Markdown changelog grouped by kind of
+// change rather than by object, to post as a pull request comment.
+func renderChangelog(d *schemaDiff) string {
+	var sb strings.Builder
+	sb.WriteString(changelogMarker + "\n## Schema changes\n\n")
+	if d.empty() {
+		sb.WriteString("No schema changes.\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%s.\n", d.counts())
+
+	section := func(heading string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n### %s\n\n", heading)
+		for _, l := range lines {
+			fmt.Fprintf(&sb, "- %s\n", l)
+		}
+	}
+	objects := func(changes []objectChange, change string) []string {
+		var out []string
+		for _, c := range changes {
+			if c.Change != change {
+				continue
+			}
+			if c.Kind == "table" || c.Kind == "view" {
+				out = append(out, mdCode(c.Label))
+			} else {
+				out = append(out, fmt.Sprintf("%s (%s)", mdCode(c.Label), c.Kind))
+			}
+		}
+		return out
+	}
+
+	var colsAdded, colsDropped, colsRetyped, colsChanged, fksAdded, fksRemoved, constraints []string
+	for _, c := range d.Tables {
+		if c.Change != changeChanged {
+			continue
+		}
+		for _, cc := range c.Columns {
+			col := mdCode(c.Label + "." + cc.Name)
+			switch cc.Change {
+			case changeAdded:
+				colsAdded = append(colsAdded, col+" "+mdCode(cc.New.Type))
+			case changeRemoved:
+				colsDropped = append(colsDropped, col+" "+mdCode(cc.Old.Type))
+			default:
+				if cc.Old.Type != cc.New.Type {
+					colsRetyped = append(colsRetyped, fmt.Sprintf("%s: %s → %s", col, mdCode(cc.Old.Type), mdCode(cc.New.Type)))
+				}
+				if flags := cc.flags(); len(flags) > 0 {
+					colsChanged = append(colsChanged, col+": "+strings.Join(flags, ", "))
+				}
+			}
+			var old, cur *FK
+			if cc.Old != nil {
+				old = cc.Old.ForeignKey
+			}
+			if cc.New != nil {
+				cur = cc.New.ForeignKey
+			}
+			if !old.same(cur) {
+				if old != nil {
+					fksRemoved = append(fksRemoved, changelogFK(c.Label, []string{cc.Name}, old))
+				}
+				if cur != nil {
+					fksAdded = append(fksAdded, changelogFK(c.Label, []string{cc.Name}, cur))
+				}
+			}
+		}
+		for _, fc := range c.FKs {
+			if fc.Change == changeAdded {
+				fksAdded = append(fksAdded, changelogFK(c.Label, fc.FK.SrcCols, &fc.FK))
+			} else {
+				fksRemoved = append(fksRemoved, changelogFK(c.Label, fc.FK.SrcCols, &fc.FK))
+			}
+		}
+		for _, cc := range c.Constraints {
+			switch cc.Change {
+			case changeChanged:
+				constraints = append(constraints, fmt.Sprintf("%s changed %s: %s → %s", mdCode(c.Label), cc.New.describe(), mdCode(cc.Old.Description), mdCode(cc.New.Description)))
+			case changeAdded:
+				constraints = append(constraints, fmt.Sprintf("%s added %s%s", mdCode(c.Label), cc.New.describe(), changelogDefinition(cc.New)))
+			default:
+				constraints = append(constraints, fmt.Sprintf("%s dropped %s", mdCode(c.Label), cc.Old.describe()))
+			}
+		}
+	}
+
+	var viewsRedefined []string
+	for _, c := range d.Views {
+		if c.Change == changeChanged {
+			viewsRedefined = append(viewsRedefined, mdCode(c.Label))
+		}
+	}
+
+	var valuesAdded, valuesRemoved, typesChanged []string
+	for _, c := range d.Types {
+		if c.Change != changeChanged {
+			continue
+		}
+		if len(c.AddedValues) > 0 {
+			valuesAdded = append(valuesAdded, mdCode(c.Label)+": "+mdCodes(c.AddedValues))
+		}
+		if len(c.RemovedValues) > 0 {
+			valuesRemoved = append(valuesRemoved, mdCode(c.Label)+": "+mdCodes(c.RemovedValues))
+		}
+		var changes []string
+		for _, cc := range c.Columns {
+			switch cc.Change {
+			case changeAdded:
+				changes = append(changes, "added field "+mdCode(cc.Name))
+			case changeRemoved:
+				changes = append(changes, "dropped field "+mdCode(cc.Name))
+			default:
+				changes = append(changes, fmt.Sprintf("field %s: %s", mdCode(cc.Name), strings.Join(cc.details(), ", ")))
+			}
+		}
+		changes = append(changes, c.Details...)
+		if len(changes) > 0 {
+			typesChanged = append(typesChanged, fmt.Sprintf("%s (%s): %s", mdCode(c.Label), c.Kind, strings.Join(changes, ", ")))
+		}
+	}
+
+	section("Tables added", objects(d.Tables, changeAdded))
+	section("Tables dropped", objects(d.Tables, changeRemoved))
+	section("Columns added", colsAdded)
+	section("Columns dropped", colsDropped)
+	section("Columns retyped", colsRetyped)
+	section("Columns changed", colsChanged)
+	section("Foreign keys added", fksAdded)
+	section("Foreign keys removed", fksRemoved)
+	section("Constraints changed", constraints)
+	section("Views added", objects(d.Views, changeAdded))
+	section("Views dropped", objects(d.Views, changeRemoved))
+	section("Views redefined", viewsRedefined)
+	section("Types added", objects(d.Types, changeAdded))
+	section("Types dropped", objects(d.Types, changeRemoved))
+	section("Enum values added", valuesAdded)
+	section("Enum values removed", valuesRemoved)
+	section("Types changed", typesChanged)
+	return sb.String()
+}
+
+// changelogFK is a foreign key as `table(cols)` → `table(cols)`.
+func changelogFK(table string, cols []string, fk *FK) string {
+	dst := tableLabel(fk.DstSchema, fk.DstTable)
+	if len(fk.DstCols) > 0 {
+		dst += "(" + strings.Join(fk.DstCols, ", ") + ")"
+	}
+	return fmt.Sprintf("%s → %s", mdCode(table+"("+strings.Join(cols, ", ")+")"), mdCode(dst))
+}
+
+// changelogDefinition is a named constraint's definition, which describe
+// leaves out.
+func changelogDefinition(c *TableConstraint) string {
+	if c.Name == "" {
+		return ""
+	}
+	return " " + mdCode(c.Description)
+}
+
+func mdCodes(vs []string) string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = mdCode(v)
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderChangelog(t *testing.T) {
+	old := parseTestSQL(t, `
+CREATE TYPE mood AS ENUM ('sad', 'ok');
+CREATE TYPE addr AS (street text);
+CREATE TABLE users (id int PRIMARY KEY, email text, nick text, CONSTRAINT email_len CHECK (length(email) < 100));
+CREATE TABLE posts (id int, user_id int REFERENCES users(id), title text);
+CREATE TABLE gone (id int);
+CREATE VIEW v AS SELECT id FROM users WHERE id > 1;
+`)
+	cur := parseTestSQL(t, `
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+CREATE TYPE addr AS (street text, city text);
+CREATE TABLE users (id bigint PRIMARY KEY, email text NOT NULL, m mood, CONSTRAINT email_len CHECK (length(email) < 200));
+CREATE TABLE posts (id int, user_id int, title text, editor_id int, UNIQUE (user_id, title), FOREIGN KEY (editor_id) REFERENCES users(id));
+CREATE TABLE fresh (id int);
+CREATE VIEW v AS SELECT id FROM users WHERE id > 2;
+`)
+	want := changelogMarker + "\n## Schema changes\n\n" +
+		"1 table added, 1 table removed, 2 tables changed, 1 view changed, 2 types changed.\n\n" +
+		"### Tables added\n\n- `fresh`\n\n" +
+		"### Tables dropped\n\n- `gone`\n\n" +
+		"### Columns added\n\n- `posts.editor_id` `int4`\n- `users.m` `mood`\n\n" +
+		"### Columns dropped\n\n- `users.nick` `text`\n\n" +
+		"### Columns retyped\n\n- `users.id`: `int4` → `int8`\n\n" +
+		"### Columns changed\n\n- `users.email`: now not null\n\n" +
+		"### Foreign keys added\n\n- `posts(editor_id)` → `users(id)`\n\n" +
+		"### Foreign keys removed\n\n- `posts(user_id)` → `users(id)`\n\n" +
+		"### Constraints changed\n\n" +
+		"- `posts` added unique `(user_id, title)`\n" +
+		"- `users` changed check `email_len`: `length(email) < 100` → `length(email) < 200`\n\n" +
+		"### Views redefined\n\n- `v`\n\n" +
+		"### Enum values added\n\n- `mood`: `happy`\n\n" +
+		"### Enum values removed\n\n- `mood`: `ok`\n\n" +
+		"### Types changed\n\n- `addr` (composite): added field `city`\n"
+	if got := renderChangelog(diffSchemas(old, cur)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderChangelogRedefinedView(t *testing.T) {
+	old := parseTestSQL(t, "CREATE TABLE users (id int, active bool);\nCREATE VIEW active_users AS SELECT id FROM users;")
+	cur := parseTestSQL(t, "CREATE TABLE users (id int, active bool);\nCREATE VIEW active_users AS SELECT id FROM users WHERE active;")
+
+	got := renderChangelog(diffSchemas(old, cur))
+	if !strings.Contains(got, "### Views redefined\n\n- `active_users`\n") || strings.Contains(got, "No schema changes.") {
+		t.Errorf("the redefined view is missing:\n%s", got)
+	}
+	if got := renderChangelog(diffSchemas(cur, cur)); got != changelogMarker+"\n## Schema changes\n\nNo schema changes.\n" {
+		t.Errorf("diffing a schema with itself gave:\n%s", got)
+	}
+}
+
+func TestRenderChangelogMigrations(t *testing.T) {
+	files := writeAlterMigrations(t, t.TempDir())
+	old, err := parseMigrations(slices.Clone(files), enginePostgreSQL, "1", os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := parseMigrations(files, enginePostgreSQL, "2", os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := changelogMarker + "\n## Schema changes\n\n" +
+		"2 tables changed.\n\n" +
+		"### Columns added\n\n- `users.user_id` `int4`\n\n" +
+		"### Columns dropped\n\n- `users.id` `int4`\n\n" +
+		"### Columns retyped\n\n- `users.name`: `text` → `varchar(40)`\n\n" +
+		"### Foreign keys added\n\n- `posts(editor)` → `users(user_id)`\n\n" +
+		"### Foreign keys removed\n\n- `posts(editor)` → `users(id)`\n- `posts(author)` → `users(id)`\n\n" +
+		"### Constraints changed\n\n- `users` dropped check `name_len`\n"
+	if got := renderChangelog(diffSchemas(old, cur)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// hashMarker starts the comment stamped in front of every SVG, holding a hash
+// of what it was rendered from.
+const hashMarker = "<!-- sqlc-viz-plugin:hash "
+
+// stampSVG puts a hash of the D2 source and render settings an SVG was made
+// from in front of it, after any XML declaration. check compares the hashes
+// instead of the SVGs, whose bytes also depend on the d2 version, its fonts
+// and its layout engines.
+func stampSVG(svg []byte, src string, settings ...string) []byte {
+	h := sha256.New()
+	h.Write([]byte(src))
+	for _, s := range settings {
+		h.Write([]byte{0})
+		h.Write([]byte(s))
+	}
+	stamp := hashMarker + hex.EncodeToString(h.Sum(nil)) + " -->"
+
+	i := 0
+	if bytes.HasPrefix(svg, []byte("<?xml")) {
+		if j := bytes.Index(svg, []byte("?>")); j >= 0 {
+			i = j + 2
+		}
+	}
+	out := make([]byte, 0, len(svg)+len(stamp))
+	out = append(out, svg[:i]...)
+	out = append(out, stamp...)
+	return append(out, svg[i:]...)
+}
+
+// withoutStampedSVGs replaces every stamped SVG in s, whether it's an SVG file
+// or inlined in HTML, with just its stamp.
+func withoutStampedSVGs(s string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, hashMarker)
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		end := strings.Index(s[i:], "-->")
+		if end < 0 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		end += i + len("-->")
+		sb.WriteString(s[:end])
+		s = s[end+svgLen(s[end:]):]
+	}
+}
+
+// svgLen is the length of the svg element s starts with, nested ones and
+// all, or 0 if it doesn't start with one.
+func svgLen(s string) int {
+	if !strings.HasPrefix(s, "<svg") {
+		return 0
+	}
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "<svg"):
+			depth++
+			i += len("<svg")
+		case strings.HasPrefix(s[i:], "</svg>"):
+			depth--
+			i += len("</svg>")
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(s)
+}
+
+// outdated lists the files whose content on disk differs from what was just
+// generated, ignoring differences inside stamped SVGs with the same stamp.
+func outdated(files []file) ([]string, error) {
+	var out []string
+	for _, f := range files {
+		b, err := os.ReadFile(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			out = append(out, f.path+" is missing")
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", f.path, err)
+		}
+		if string(b) == f.content || withoutStampedSVGs(string(b)) == withoutStampedSVGs(f.content) {
+			continue
+		}
+		out = append(out, f.path+" is out of date")
+	}
+	return out, nil
+}
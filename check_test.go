@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStampSVG(t *testing.T) {
+	svg := []byte(`<?xml version="1.0"?><svg></svg>`)
+	a := string(stampSVG(svg, "a: b", "elk"))
+	if !strings.HasPrefix(a, `<?xml version="1.0"?>`+hashMarker) || !strings.HasSuffix(a, " --><svg></svg>") {
+		t.Errorf("stamp isn't between the declaration and the svg: %s", a)
+	}
+	if b := string(stampSVG([]byte("<svg></svg>"), "a: b", "elk")); !strings.HasPrefix(b, hashMarker) {
+		t.Errorf("stamp isn't in front of the svg: %s", b)
+	}
+	stamp := func(src string, settings ...string) string {
+		return string(stampSVG(nil, src, settings...))
+	}
+	if stamp("a: b", "elk") != stamp("a: b", "elk") {
+		t.Error("the same source and settings gave different stamps")
+	}
+	for _, other := range []string{stamp("a: c", "elk"), stamp("a: b", "dagre"), stamp("a: b"), stamp("a: b", "el", "k")} {
+		if other == stamp("a: b", "elk") {
+			t.Errorf("%s stamps like a different source or settings", other)
+		}
+	}
+}
+
+func TestWithoutStampedSVGs(t *testing.T) {
+	svg := string(stampSVG([]byte(`<?xml version="1.0"?><svg><svg id="inner"></svg><text>x</text></svg>`), "a: b"))
+	stamp := svg[len(`<?xml version="1.0"?>`) : len(svg)-len(`<svg><svg id="inner"></svg><text>x</text></svg>`)]
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"file", svg, `<?xml version="1.0"?>` + stamp},
+		{"inlined", "<div>" + svg[len(`<?xml version="1.0"?>`):] + "</div><p>after</p>", "<div>" + stamp + "</div><p>after</p>"},
+		{"unstamped", "<div><svg></svg></div>", "<div><svg></svg></div>"},
+		{"unterminated stamp", hashMarker + "abc <svg></svg>", hashMarker + "abc <svg></svg>"},
+	}
+	for _, tt := range tests {
+		if got := withoutStampedSVGs(tt.in); got != tt.want {
+			t.Errorf("%s: got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSVGLen(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"<svg></svg> rest", len("<svg></svg>")},
+		{"<svg><svg></svg></svg></div>", len("<svg><svg></svg></svg>")},
+		{"<svg><g>", len("<svg><g>")},
+		{"<div><svg></svg>", 0},
+	}
+	for _, tt := range tests {
+		if got := svgLen(tt.in); got != tt.want {
+			t.Errorf("svgLen(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	stamped := func(body, src string) string {
+		return string(stampSVG([]byte(`<?xml version="1.0"?><svg>`+body+`</svg>`), src, "elk"))
+	}
+
+	same := write("same.d2", "a: b")
+	rerendered := write("rerendered.svg", stamped("old fonts", "a: b"))
+	changed := write("changed.svg", stamped("x", "a: b"))
+	edited := write("edited.d2", "a: b")
+	missing := filepath.Join(dir, "missing.svg")
+
+	got, err := outdated([]file{
+		{path: same, content: "a: b"},
+		// the same source renders differently with another d2
+		{path: rerendered, content: stamped("new fonts", "a: b")},
+		{path: changed, content: stamped("x", "a: c")},
+		{path: edited, content: "a: c"},
+		{path: missing, content: stamped("x", "a: b")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{changed + " is out of date", edited + " is out of date", missing + " is missing"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
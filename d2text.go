@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+)
+
+// d2Map is a block of D2 source being written. Keys are set once, in the
+// order they first appear, and can have a value, a block of their own or
+// both. Edges are added rather than set, every one is a new edge.
+//
+// The diagram is built as text rather than with d2's graph compiler, which
+// doesn't build for wasip1, so the wasm build writes the same source the
+// native one lays out.
+type d2Map struct {
+	fields []*d2Field
+	byKey  map[string]*d2Field
+}
+
+type d2Field struct {
+	key   string
+	value *string
+	m     *d2Map
+}
+
+// field returns the field for an already formatted key, creating it.
+func (m *d2Map) field(key string) *d2Field {
+	if f := m.byKey[key]; f != nil {
+		return f
+	}
+	if m.byKey == nil {
+		m.byKey = map[string]*d2Field{}
+	}
+	f := &d2Field{key: key}
+	m.fields = append(m.fields, f)
+	m.byKey[key] = f
+	return f
+}
+
+// set sets key to the value, quoting it if it needs to be.
+func (m *d2Map) set(key, value string) {
+	v := d2Value(value)
+	m.field(key).value = &v
+}
+
+// get returns the block of key, creating it.
+func (m *d2Map) get(key string) *d2Map {
+	f := m.field(key)
+	if f.m == nil {
+		f.m = &d2Map{}
+	}
+	return f.m
+}
+
+// has says whether key, or anything under it, is set.
+func (m *d2Map) has(key string) bool {
+	for _, f := range m.fields {
+		if f.key == key || strings.HasPrefix(f.key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// unique returns name, or name followed by the first number that makes it a
+// key m doesn't have yet, the way d2 names new shapes.
+func (m *d2Map) unique(name string) string {
+	k := name
+	for i := 2; m.has(k); i++ {
+		k = fmt.Sprintf("%s %d", name, i)
+	}
+	return k
+}
+
+// edge adds an edge, labelled unless label is "", and returns its block.
+func (m *d2Map) edge(src, op, dst, label string) *d2Map {
+	f := &d2Field{key: src + " " + op + " " + dst, m: &d2Map{}}
+	if label != "" {
+		v := d2Value(label)
+		f.value = &v
+	}
+	m.fields = append(m.fields, f)
+	return f.m
+}
+
+func (m *d2Map) write(sb *strings.Builder, indent string) {
+	for _, f := range m.fields {
+		sb.WriteString(indent + f.key)
+		if f.value != nil || f.m != nil && len(f.m.fields) > 0 {
+			sb.WriteString(":")
+		}
+		if f.value != nil {
+			sb.WriteString(" " + *f.value)
+		}
+		if f.m != nil && len(f.m.fields) > 0 {
+			sb.WriteString(" {\n")
+			f.m.write(sb, indent+"  ")
+			sb.WriteString(indent + "}")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+func (m *d2Map) String() string {
+	var sb strings.Builder
+	m.write(&sb, "")
+	return sb.String()
+}
+
+// d2Key is a dotted label as a D2 key, each part quoted if it needs to be.
+func d2Key(label string) string {
+	return d2format.Format(d2ast.MakeKeyPath(strings.Split(label, ".")))
+}
+
+// d2Value is s as a D2 value, quoted if it needs to be.
+func d2Value(s string) string {
+	return d2format.Format(d2ast.RawString(s, false))
+}
+
+// visibleCols returns the columns of t drawn at the given detail level. FKs
+// have to reference a PK or unique column, so the "keys" level still leaves
+// every FK edge with a column to land on.
+func visibleCols(t *Table, detail string) []Column {
+	switch detail {
+	case detailTables:
+		return nil
+	case detailKeys:
+		var cols []Column
+		for _, c := range t.Cols {
+			if c.PrimaryKey || c.Unique || c.ForeignKey != nil {
+				cols = append(cols, c)
+			}
+		}
+		return cols
+	default:
+		return t.Cols
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestD2Map(t *testing.T) {
+	root := &d2Map{}
+	users := root.get("users")
+	users.set("class", "table")
+	users.set("id", "int8")
+	users.get("id").set("constraint", "PK")
+	users.set("note", "a; b")
+	root.get("views").set("class", "views")
+	root.edge("posts.user_id", "->", "users.id", "")
+	root.edge("posts.user_id", "->", "users.id", "")
+	root.edge("a.x", "--", "b.y", "join").set("style.stroke-dash", "3")
+	// setting a key again changes it in place
+	users.set("class", "view")
+
+	want := `users: {
+  class: view
+  id: int8 {
+    constraint: PK
+  }
+  note: "a; b"
+}
+views: {
+  class: views
+}
+posts.user_id -> users.id
+posts.user_id -> users.id
+a.x -- b.y: join {
+  style.stroke-dash: 3
+}
+`
+	if got := root.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	for name, want := range map[string]string{"users": "users 2", "views": "views 2", "enums": "enums"} {
+		if got := root.unique(name); got != want {
+			t.Errorf("unique(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestD2Key(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"users", "users"},
+		{"billing.invoices", "billing.invoices"},
+		{"order items", "order items"},
+		{"a;b", `"a;b"`},
+		{"x:y", `"x:y"`},
+	}
+	for _, tt := range tests {
+		if got := d2Key(tt.label); got != tt.want {
+			t.Errorf("d2Key(%q) = %s, want %s", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestRenderD2Text(t *testing.T) {
+	tables := map[string]*Table{
+		"users": {Name: "users", Cols: []Column{{Name: "id", Type: "int8", PrimaryKey: true}, {Name: "name", Type: "text"}}},
+		"posts": {Name: "posts", Cols: []Column{
+			{Name: "id", Type: "int8", PrimaryKey: true},
+			{Name: "user_id", Type: "int8", ForeignKey: &FK{SrcCols: []string{"user_id"}, DstTable: "users", DstCols: []string{"id"}}},
+		}},
+		// takes the key views are grouped in
+		"views": {Name: "views", Cols: []Column{{Name: "n", Type: "int4"}}},
+	}
+	views := map[string]*View{"recent": {Name: "recent", Cols: []Column{{Name: "id", Type: "unknown"}}}}
+	types := map[string]*CustomType{"mood": {Name: "mood", TypeKind: "enum", Values: []string{"sad", "happy"}}}
+
+	got, err := renderD2Text(tables, nil, views, types, renderOptions{detail: detailKeys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := strings.CutPrefix(got, strings.TrimPrefix(classesSection(), "\n")+"\n")
+	if !ok {
+		t.Fatalf("doesn't start with the classes:\n%s", got)
+	}
+	want := `posts: {
+  class: table
+  id: int8 {
+    constraint: PK
+  }
+  user_id: int8 {
+    constraint: FK
+  }
+}
+users: {
+  class: table
+  id: int8 {
+    constraint: PK
+  }
+}
+views: {
+  class: table
+}
+posts.user_id -> users.id
+views 2: {
+  class: views
+  recent: {
+    class: view
+    id: ""
+  }
+}
+enums: {
+  class: enums
+  mood: {
+    class: enum
+    sad: ""
+    happy: ""
+  }
+}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	dbmlPlainName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	dbmlPlainType = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_(),]*$`)
+)
+
+// renderDBML writes the schema as DBML for dbdiagram.io. Multi-column unique
+// constraints become unique indexes, other table constraints table notes and
+// views, which DBML can't describe, sticky notes with their columns.
+func renderDBML(s *Schema) string {
+	var sb strings.Builder
+
+	for _, k := range sortedKeys(s.Types) {
+		ct := s.Types[k]
+		if ct.TypeKind != "enum" {
+			continue
+		}
+		fmt.Fprintf(&sb, "Enum %s {\n", dbmlTable(ct.Schema, ct.Name))
+		for _, v := range ct.Values {
+			fmt.Fprintf(&sb, "  %s\n", dbmlName(v))
+		}
+		sb.WriteString("}\n\n")
+	}
+
+	for _, k := range sortedKeys(s.Tables) {
+		t := s.Tables[k]
+		fmt.Fprintf(&sb, "Table %s {\n", dbmlTable(t.Schema, t.Name))
+		for _, c := range t.Cols {
+			fmt.Fprintf(&sb, "  %s %s", dbmlName(c.Name), dbmlType(c.Type))
+			var settings []string
+			if c.PrimaryKey {
+				settings = append(settings, "pk")
+			}
+			if c.Unique {
+				settings = append(settings, "unique")
+			}
+			if c.NotNull && !c.PrimaryKey {
+				settings = append(settings, "not null")
+			}
+			if len(settings) > 0 {
+				fmt.Fprintf(&sb, " [%s]", strings.Join(settings, ", "))
+			}
+			sb.WriteString("\n")
+		}
+		if len(t.Uniques) > 0 {
+			sb.WriteString("\n  indexes {\n")
+			for _, u := range t.Uniques {
+				fmt.Fprintf(&sb, "    %s [unique]\n", dbmlCols(u))
+			}
+			sb.WriteString("  }\n")
+		}
+		if len(t.Constraints) > 0 {
+			var notes []string
+			for _, con := range t.Constraints {
+				notes = append(notes, strings.TrimSpace(con.Name+" "+con.Description))
+			}
+			fmt.Fprintf(&sb, "\n  Note: %s\n", dbmlString(strings.Join(notes, "\n")))
+		}
+		sb.WriteString("}\n\n")
+	}
+
+	for _, r := range s.relations() {
+		op := ">"
+		if r.Unique {
+			op = "-"
+		}
+		fmt.Fprintf(&sb, "Ref: %s.%s %s %s.%s\n",
+			dbmlTable(r.From.Schema, r.From.Name), dbmlCols(r.FromCols), op,
+			dbmlTable(r.To.Schema, r.To.Name), dbmlCols(r.ToCols))
+	}
+
+	for _, k := range sortedKeys(s.Views) {
+		v := s.Views[k]
+		var cols []string
+		for _, c := range v.Cols {
+			cols = append(cols, strings.TrimSpace(c.Name+" "+strings.TrimPrefix(c.Type, "unknown")))
+		}
+		fmt.Fprintf(&sb, "\nNote %s {\n  %s\n}\n", dbmlName("view_"+strings.ReplaceAll(tableLabel(v.Schema, v.Name), ".", "_")),
+			dbmlString(fmt.Sprintf("View %s: %s", tableLabel(v.Schema, v.Name), strings.Join(cols, ", "))))
+	}
+	return sb.String()
+}
+
+func dbmlName(s string) string {
+	if dbmlPlainName.MatchString(s) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func dbmlTable(schema, name string) string {
+	if schema == "" || schema == "public" {
+		return dbmlName(name)
+	}
+	return dbmlName(schema) + "." + dbmlName(name)
+}
+
+func dbmlType(t string) string {
+	t = strings.ReplaceAll(strings.TrimPrefix(t, "pg_catalog."), ", ", ",")
+	if t == "" {
+		t = "unknown"
+	}
+	if dbmlPlainType.MatchString(t) {
+		return t
+	}
+	return `"` + strings.ReplaceAll(t, `"`, `\"`) + `"`
+}
+
+// dbmlCols references one column as is and several as a composite (a, b).
+func dbmlCols(cols []string) string {
+	if len(cols) == 1 {
+		return dbmlName(cols[0])
+	}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = dbmlName(c)
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func dbmlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`).Replace(s) + "'"
+}
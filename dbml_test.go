@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestRenderDBML(t *testing.T) {
+	want := `Table audit {
+  project_id int4
+  user_id int4
+}
+
+Table profiles {
+  user_id int4 [unique]
+  bio text
+}
+
+Table project_members {
+  project_id int4
+  user_id int4
+  role text
+
+  indexes {
+    (project_id, user_id) [unique]
+  }
+}
+
+Table projects {
+  id int4 [pk]
+  name text [not null]
+}
+
+Table users {
+  id int4 [pk]
+  email text [unique]
+}
+
+Ref: profiles.user_id - users.id
+Ref: project_members.project_id > projects.id
+Ref: project_members.user_id > users.id
+`
+	if got := renderDBML(parseTestSQL(t, membersSQL)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderDBMLQuoting(t *testing.T) {
+	s := parseTestSQL(t, `
+CREATE TYPE mood AS ENUM ('sad', 'so so');
+CREATE TABLE billing."order items" (id int, price numeric(10, 2), CHECK (price > 0));
+CREATE VIEW cheap AS SELECT id FROM billing."order items";
+`)
+	want := `Enum mood {
+  sad
+  "so so"
+}
+
+Table billing."order items" {
+  id int4
+  price numeric(10,2)
+
+  Note: 'price > 0'
+}
+
+
+Note view_cheap {
+  'View cheap: id'
+}
+`
+	if got := renderDBML(s); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseDDL parses a MySQL or SQLite migration into the model. sqlc keeps its
+// parsers for both in internal packages, and the pure Go MySQL parser it
+// wraps, github.com/pingcap/tidb/pkg/parser, doesn't read SQLite, so this is
+// a small tokenizer that understands the DDL statements that shape a schema
+// diagram and skips everything else.
+func parseDDL(path string, up []byte, engine string, s *Schema) error {
+	toks, err := tokenizeDDL(string(up), engine)
+	if err != nil {
+		return fmt.Errorf("failed to parse SQL in %s: %w", path, err)
+	}
+
+	for _, stmt := range splitTokens(toks, ";") {
+		if len(stmt) == 0 {
+			continue
+		}
+		loc := &Location{File: path, Line: strings.Count(string(up[:stmt[0].start]), "\n") + 1}
+		p := &ddlStmt{toks: stmt, src: string(up), engine: engine, loc: loc}
+		p.parse(s)
+	}
+	return nil
+}
+
+type ddlTokenKind int
+
+const (
+	tokWord   ddlTokenKind = iota // keyword, bare identifier or number
+	tokQuoted                     // "quoted", `quoted` or [quoted] identifier
+	tokString                     // 'string literal', or "string literal" in MySQL
+	tokPunct
+)
+
+type ddlToken struct {
+	kind       ddlTokenKind
+	text       string
+	start, end int
+}
+
+// tokenizeDDL splits src into tokens. MySQL double quotes strings unless
+// ANSI_QUOTES is set, which the tokenizer follows for the rest of the file
+// when a SET sql_mode statement turns it on or off.
+func tokenizeDDL(src, engine string) ([]ddlToken, error) {
+	var toks []ddlToken
+	ansiQuotes, stmt := false, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "--") || (c == '#' && engine == engineMySQL):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || (c == '"' && engine == engineMySQL && !ansiQuotes):
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src); j++ {
+				if src[j] == '\\' && engine == engineMySQL && j+1 < len(src) {
+					j++
+					sb.WriteByte(src[j])
+					continue
+				}
+				if src[j] == c {
+					if j+1 < len(src) && src[j+1] == c {
+						sb.WriteByte(c)
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, ddlToken{kind: tokString, text: sb.String(), start: i, end: j + 1})
+			i = j + 1
+		case c == '"' || c == '`' || (c == '[' && engine == engineSQLite):
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(src[i+1:], closing)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier")
+			}
+			toks = append(toks, ddlToken{kind: tokQuoted, text: src[i+1 : i+1+end], start: i, end: i + end + 2})
+			i += end + 2
+		case isWordByte(c):
+			j := i
+			for j < len(src) && isWordByte(src[j]) {
+				j++
+			}
+			toks = append(toks, ddlToken{kind: tokWord, text: src[i:j], start: i, end: j})
+			i = j
+		default:
+			toks = append(toks, ddlToken{kind: tokPunct, text: string(c), start: i, end: i + 1})
+			i++
+			if c == ';' && engine == engineMySQL {
+				if on, ok := setsANSIQuotes(toks[stmt:]); ok {
+					ansiQuotes = on
+				}
+				stmt = len(toks)
+			}
+		}
+	}
+	return toks, nil
+}
+
+// setsANSIQuotes reports whether a statement is a SET of sql_mode, and if so
+// whether the modes it sets include ANSI_QUOTES, directly or through ANSI.
+// Modes appended with CONCAT(@@sql_mode, ',ANSI_QUOTES') count too.
+func setsANSIQuotes(stmt []ddlToken) (on, ok bool) {
+	if len(stmt) == 0 || !isKeyword(stmt[0], "SET") {
+		return false, false
+	}
+	for _, t := range stmt {
+		if isKeyword(t, "sql_mode") {
+			ok = true
+		}
+		if t.kind != tokString {
+			continue
+		}
+		for _, mode := range strings.Split(t.text, ",") {
+			if m := strings.TrimSpace(mode); strings.EqualFold(m, "ANSI_QUOTES") || strings.EqualFold(m, "ANSI") {
+				on = true
+			}
+		}
+	}
+	return on, ok
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// splitTokens splits toks on a punctuation token outside of parentheses.
+func splitTokens(toks []ddlToken, sep string) [][]ddlToken {
+	var out [][]ddlToken
+	depth, last := 0, 0
+	for i, t := range toks {
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case sep:
+			if depth == 0 {
+				out = append(out, toks[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(out, toks[last:])
+}
+
+// ddlStmt is a cursor over the tokens of a single statement.
+type ddlStmt struct {
+	toks   []ddlToken
+	pos    int
+	src    string
+	engine string
+	loc    *Location // where the statement starts
+}
+
+func (p *ddlStmt) done() bool {
+	return p.pos >= len(p.toks)
+}
+
+func (p *ddlStmt) peek() ddlToken {
+	if p.done() {
+		return ddlToken{}
+	}
+	return p.toks[p.pos]
+}
+
+// isKeyword reports whether t is an unquoted word matching one of kws.
+func isKeyword(t ddlToken, kws ...string) bool {
+	if t.kind != tokWord {
+		return false
+	}
+	for _, kw := range kws {
+		if strings.EqualFold(t.text, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// accept consumes the given keywords if they're next, in order.
+func (p *ddlStmt) accept(kws ...string) bool {
+	if p.pos+len(kws) > len(p.toks) {
+		return false
+	}
+	for i, kw := range kws {
+		if !isKeyword(p.toks[p.pos+i], kw) {
+			return false
+		}
+	}
+	p.pos += len(kws)
+	return true
+}
+
+func (p *ddlStmt) acceptPunct(s string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ddlStmt) ident() string {
+	t := p.peek()
+	if t.kind != tokWord && t.kind != tokQuoted {
+		return ""
+	}
+	p.pos++
+	return t.text
+}
+
+// name reads a possibly schema-qualified object name.
+func (p *ddlStmt) name() (schema, name string) {
+	name = p.ident()
+	if p.acceptPunct(".") {
+		schema, name = name, p.ident()
+	}
+	return schema, name
+}
+
+// group consumes a parenthesised group and returns the tokens inside it.
+func (p *ddlStmt) group() []ddlToken {
+	if !p.acceptPunct("(") {
+		return nil
+	}
+	start, depth := p.pos, 1
+	for ; !p.done(); p.pos++ {
+		t := p.toks[p.pos]
+		if t.kind != tokPunct {
+			continue
+		}
+		if t.text == "(" {
+			depth++
+		} else if t.text == ")" {
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.toks[start : p.pos-1]
+			}
+		}
+	}
+	return p.toks[start:]
+}
+
+// text returns the source text spanned by toks with whitespace collapsed.
+func (p *ddlStmt) text(toks []ddlToken) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	return strings.Join(strings.Fields(p.src[toks[0].start:toks[len(toks)-1].end]), " ")
+}
+
+// identList reads the first identifier of each comma separated item, which
+// drops key lengths and sort orders like "name(10) DESC".
+func identList(toks []ddlToken) []string {
+	var out []string
+	for _, item := range splitTokens(toks, ",") {
+		if len(item) > 0 && (item[0].kind == tokWord || item[0].kind == tokQuoted) {
+			out = append(out, item[0].text)
+		}
+	}
+	return out
+}
+
+func (p *ddlStmt) parse(s *Schema) {
+	switch {
+	case p.accept("CREATE"):
+		p.accept("OR", "REPLACE")
+		// skip TEMPORARY, UNIQUE and MySQL view options like ALGORITHM=...
+		for !p.done() && !isKeyword(p.peek(), "TABLE", "VIEW", "INDEX", "TRIGGER") {
+			p.pos++
+		}
+		switch {
+		case p.accept("TABLE"):
+			p.createTable(s)
+		case p.accept("VIEW"):
+			p.createView(s)
+		}
+	case p.accept("ALTER", "TABLE"):
+		p.alterTable(s)
+	case p.accept("DROP", "TABLE"):
+		p.accept("IF", "EXISTS")
+		for _, item := range splitTokens(p.toks[p.pos:], ",") {
+			q := &ddlStmt{toks: item, src: p.src}
+			sch, tn := q.name()
+			delete(s.Tables, key(sch, tn))
+		}
+	case p.accept("DROP", "VIEW"):
+		p.accept("IF", "EXISTS")
+		for _, item := range splitTokens(p.toks[p.pos:], ",") {
+			q := &ddlStmt{toks: item, src: p.src}
+			sch, vn := q.name()
+			delete(s.Views, key(sch, vn))
+		}
+	}
+}
+
+func (p *ddlStmt) createTable(s *Schema) {
+	p.accept("IF", "NOT", "EXISTS")
+	sch, tn := p.name()
+	if tn == "" {
+		return
+	}
+	// CREATE TABLE ... AS SELECT and ... LIKE other have no definitions to read
+	defs := p.group()
+	if defs == nil {
+		return
+	}
+
+	t := ensureTable(s.Tables, sch, tn)
+	if t.Created == nil {
+		t.Created = p.loc
+	} else {
+		t.Altered = alteredAt(t.Altered, t.Created, p.loc)
+	}
+	for _, def := range splitTokens(defs, ",") {
+		if len(def) == 0 {
+			continue
+		}
+		q := &ddlStmt{toks: def, src: p.src, engine: p.engine, loc: p.loc}
+		if !q.tableConstraint(s, t) {
+			q.pos = 0
+			if col := q.columnDef(s, t); col.Name != "" {
+				t.Cols = upsertCol(t.Cols, col)
+			}
+		}
+	}
+}
+
+// tableConstraint parses a table-level constraint or index definition,
+// returning false if the tokens are a column definition instead.
+func (p *ddlStmt) tableConstraint(s *Schema, t *Table) bool {
+	var name string
+	if p.accept("CONSTRAINT") {
+		if !isKeyword(p.peek(), "PRIMARY", "UNIQUE", "FOREIGN", "CHECK") {
+			name = p.ident()
+		}
+	}
+
+	switch {
+	case p.accept("PRIMARY", "KEY"):
+		for _, c := range identList(p.nextGroup()) {
+			markPK(t, c, p.loc)
+		}
+	case p.accept("UNIQUE"):
+		if !p.accept("KEY") {
+			p.accept("INDEX")
+		}
+		if index := p.ident(); name == "" {
+			name = index
+		}
+		cols := identList(p.nextGroup())
+		markUnique(t, cols, p.loc)
+		if name == "" && len(cols) > 0 {
+			// MySQL names the index after its first column
+			name = cols[0]
+		}
+		nameKey(t, name, false, cols)
+	case p.accept("FOREIGN", "KEY"):
+		src := identList(p.nextGroup())
+		if fk := p.references(); fk != nil {
+			fk.Name = name
+			fk.SrcSchema, fk.SrcTable, fk.SrcCols = t.Schema, t.Name, src
+			s.FKs = append(s.FKs, *fk)
+		}
+	case p.accept("CHECK"):
+		t.Constraints = append(t.Constraints, TableConstraint{
+			Name:        name,
+			Type:        "CHECK",
+			Description: p.text(p.group()),
+			Created:     p.loc,
+		})
+	case p.indexDef():
+		// plain MySQL indexes don't show up in the diagram
+	default:
+		return name != ""
+	}
+	return true
+}
+
+// indexDef reports whether a plain MySQL index, "[FULLTEXT|SPATIAL]
+// {KEY|INDEX} [name] [USING type] (cols)", is next rather than a column called
+// key or index. The arguments of a type, as in "key VARCHAR(64)", are numbers
+// or strings where an index lists columns.
+func (p *ddlStmt) indexDef() bool {
+	q := *p
+	if q.accept("FULLTEXT") || q.accept("SPATIAL") {
+		if !q.accept("KEY") {
+			q.accept("INDEX")
+		}
+	} else if !q.accept("KEY") && !q.accept("INDEX") {
+		return false
+	}
+	if t := q.peek(); t.kind != tokPunct && !isKeyword(t, "USING") {
+		q.pos++
+	}
+	if q.accept("USING") {
+		q.ident()
+	}
+	cols := q.group()
+	if len(cols) == 0 || cols[0].kind == tokString {
+		return false
+	}
+	c := cols[0].text[0]
+	return cols[0].kind != tokWord || c < '0' || c > '9'
+}
+
+// nextGroup skips index names and KEY/INDEX keywords up to the next
+// parenthesised column list and returns it.
+func (p *ddlStmt) nextGroup() []ddlToken {
+	for !p.done() {
+		if t := p.peek(); t.kind == tokPunct && t.text == "(" {
+			return p.group()
+		}
+		p.pos++
+	}
+	return nil
+}
+
+// references parses "REFERENCES table [(cols)]". SQLite allows leaving out
+// the column list to reference the primary key.
+func (p *ddlStmt) references() *FK {
+	if !p.accept("REFERENCES") {
+		return nil
+	}
+	sch, tn := p.name()
+	fk := &FK{DstSchema: sch, DstTable: tn, Created: p.loc}
+	if t := p.peek(); t.kind == tokPunct && t.text == "(" {
+		fk.DstCols = identList(p.group())
+	}
+	return fk
+}
+
+// columnKeywords end the type part of a column definition.
+var columnKeywords = []string{
+	"NOT", "NULL", "PRIMARY", "UNIQUE", "REFERENCES", "DEFAULT", "CHECK",
+	"CONSTRAINT", "AUTO_INCREMENT", "AUTOINCREMENT", "COLLATE", "COMMENT",
+	"GENERATED", "AS", "ON", "KEY", "CHARSET", "INVISIBLE",
+	"VISIBLE", "STORED", "VIRTUAL",
+}
+
+// columnDef parses a column definition for t, returning a Column without a
+// name if there isn't one. Inline enums are added to s.
+func (p *ddlStmt) columnDef(s *Schema, t *Table) Column {
+	col := Column{Name: p.ident(), Created: p.loc}
+	if col.Name == "" {
+		return col
+	}
+
+	var words []string
+	for !p.done() && p.peek().kind == tokWord && !isKeyword(p.peek(), columnKeywords...) {
+		if p.pos+1 < len(p.toks) && isKeyword(p.peek(), "CHARACTER") && isKeyword(p.toks[p.pos+1], "SET") {
+			break
+		}
+		w := strings.ToLower(p.peek().text)
+		p.pos++
+		args := p.group()
+		switch {
+		case w == "enum" && args != nil:
+			// sqlc names inline MySQL enums after the table and column
+			ct := &CustomType{Schema: t.Schema, Name: t.Name + "_" + col.Name, TypeKind: "enum", Created: p.loc}
+			for _, a := range args {
+				if a.kind == tokString {
+					ct.Values = append(ct.Values, a.text)
+				}
+			}
+			setType(s.Types, ct, p.loc)
+			w = ct.Name
+		case args != nil:
+			var mods []string
+			for _, a := range args {
+				if a.kind != tokPunct {
+					mods = append(mods, a.text)
+				}
+			}
+			w += "(" + strings.Join(mods, ", ") + ")"
+		}
+		words = append(words, w)
+	}
+	col.Type = strings.Join(words, " ")
+
+	for !p.done() {
+		switch {
+		case p.accept("PRIMARY", "KEY"):
+			col.PrimaryKey = true
+		case p.accept("UNIQUE"):
+			col.Unique = true
+			nameKey(t, col.Name, false, []string{col.Name})
+		case p.accept("NOT", "NULL"):
+			col.NotNull = true
+		case isKeyword(p.peek(), "REFERENCES"):
+			if fk := p.references(); fk != nil {
+				fk.SrcCols = []string{col.Name}
+				col.ForeignKey = fk
+			}
+		default:
+			if p.group() == nil {
+				p.pos++
+			}
+		}
+	}
+	return col
+}
+
+func (p *ddlStmt) alterTable(s *Schema) {
+	sch, tn := p.name()
+	if tn == "" {
+		return
+	}
+	t := ensureTable(s.Tables, sch, tn)
+	t.Altered = alteredAt(t.Altered, t.Created, p.loc)
+
+	for _, action := range splitTokens(p.toks[p.pos:], ",") {
+		q := &ddlStmt{toks: action, src: p.src, engine: p.engine, loc: p.loc}
+		switch {
+		case q.accept("ADD"):
+			if q.tableConstraint(s, t) {
+				continue
+			}
+			q.pos = 1
+			q.accept("COLUMN")
+			if col := q.columnDef(s, t); col.Name != "" {
+				t.Cols = upsertCol(t.Cols, col)
+			}
+		case q.accept("DROP", "PRIMARY", "KEY"):
+			dropPrimaryKey(t, p.loc)
+		case q.accept("DROP", "FOREIGN", "KEY"), q.accept("DROP", "CONSTRAINT"), q.accept("DROP", "CHECK"),
+			q.accept("DROP", "INDEX"), q.accept("DROP", "KEY"):
+			if name := q.ident(); name != "" {
+				dropConstraint(t, &s.FKs, name, p.loc)
+			}
+		case q.accept("DROP"):
+			q.accept("COLUMN")
+			if name := q.ident(); name != "" {
+				t.Cols = removeCol(t.Cols, name)
+			}
+		case q.accept("MODIFY"):
+			q.accept("COLUMN")
+			if col := q.columnDef(s, t); col.Name != "" {
+				t.Cols = replaceCol(t.Cols, col.Name, col)
+			}
+		case q.accept("CHANGE"):
+			q.accept("COLUMN")
+			old := q.ident()
+			if col := q.columnDef(s, t); col.Name != "" {
+				renameColumn(s.Tables, s.FKs, t, old, col.Name, p.loc)
+				t.Cols = replaceCol(t.Cols, col.Name, col)
+			}
+		case q.accept("RENAME", "COLUMN"):
+			old := q.ident()
+			q.accept("TO")
+			if name := q.ident(); name != "" {
+				renameColumn(s.Tables, s.FKs, t, old, name, p.loc)
+			}
+		case q.accept("RENAME", "INDEX"), q.accept("RENAME", "KEY"):
+			old := q.ident()
+			q.accept("TO")
+			if name := q.ident(); name != "" {
+				renameConstraint(t, s.FKs, old, name)
+			}
+		case q.accept("RENAME"):
+			if !q.accept("TO") {
+				q.accept("AS")
+			}
+			if nsch, ntn := q.name(); ntn != "" {
+				renameTable(s.Tables, s.FKs, t, nsch, ntn)
+			}
+		}
+	}
+}
+
+func (p *ddlStmt) createView(s *Schema) {
+	p.accept("IF", "NOT", "EXISTS")
+	sch, vn := p.name()
+	if vn == "" {
+		return
+	}
+	view := &View{Schema: sch, Name: vn, Created: p.loc}
+
+	var names []string
+	if t := p.peek(); t.kind == tokPunct && t.text == "(" {
+		names = identList(p.group())
+	}
+	if !p.accept("AS") {
+		return
+	}
+	view.Query = p.text(p.toks[p.pos:])
+	if len(names) == 0 {
+		names = selectListNames(p.toks[p.pos:])
+	}
+	for _, n := range names {
+		view.Cols = append(view.Cols, Column{Name: n, Type: "unknown"})
+	}
+
+	if old := s.Views[key(sch, vn)]; old != nil {
+		// CREATE OR REPLACE VIEW
+		view.Created = old.Created
+		view.Altered = alteredAt(old.Altered, old.Created, p.loc)
+	}
+	s.Views[key(sch, vn)] = view
+}
+
+// selectListNames infers output column names from a SELECT list the same way
+// extractViewColumns does for PostgreSQL: the alias if there is one, else the
+// column or function name.
+func selectListNames(toks []ddlToken) []string {
+	if len(toks) == 0 || !isKeyword(toks[0], "SELECT") {
+		return nil
+	}
+	toks = toks[1:]
+	if len(toks) > 0 && isKeyword(toks[0], "DISTINCT", "ALL") {
+		toks = toks[1:]
+	}
+
+	// the select list ends at the first top-level FROM
+	depth := 0
+	for i, t := range toks {
+		if t.kind == tokPunct && t.text == "(" {
+			depth++
+		} else if t.kind == tokPunct && t.text == ")" {
+			depth--
+		} else if depth == 0 && isKeyword(t, "FROM") {
+			toks = toks[:i]
+			break
+		}
+	}
+
+	var names []string
+	for _, item := range splitTokens(toks, ",") {
+		if len(item) == 0 {
+			continue
+		}
+		last := item[len(item)-1]
+		switch {
+		case last.kind == tokPunct && last.text == "*":
+		case last.kind == tokWord || last.kind == tokQuoted:
+			names = append(names, last.text)
+		case len(item) > 1 && item[1].kind == tokPunct && item[1].text == "(":
+			names = append(names, item[0].text)
+		}
+	}
+	return names
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeDDL(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine string
+		src    string
+		want   []string // kind:text
+	}{
+		{
+			name:   "mysql strings and identifiers",
+			engine: engineMySQL,
+			src:    "`size` ENUM('small', \"large\")",
+			want:   []string{"quoted:size", "word:ENUM", "punct:(", "string:small", "punct:,", "string:large", "punct:)"},
+		},
+		{
+			name:   "mysql escapes",
+			engine: engineMySQL,
+			src:    `'it\'s' "say ""hi""" 'a''b'`,
+			want:   []string{"string:it's", `string:say "hi"`, "string:a'b"},
+		},
+		{
+			name:   "mysql comments",
+			engine: engineMySQL,
+			src:    "a # hash\n-- dashes\nb /* block */ c",
+			want:   []string{"word:a", "word:b", "word:c"},
+		},
+		{
+			name:   "mysql ANSI_QUOTES",
+			engine: engineMySQL,
+			src:    `"a"; SET SESSION sql_mode = 'STRICT_TRANS_TABLES,ANSI_QUOTES'; "b"; SET sql_mode = ''; "c"`,
+			want: []string{
+				"string:a", "punct:;",
+				"word:SET", "word:SESSION", "word:sql_mode", "punct:=", "string:STRICT_TRANS_TABLES,ANSI_QUOTES", "punct:;",
+				"quoted:b", "punct:;",
+				"word:SET", "word:sql_mode", "punct:=", "string:", "punct:;",
+				"string:c",
+			},
+		},
+		{
+			name:   "mysql ANSI mode appended",
+			engine: engineMySQL,
+			src:    `SET @@sql_mode = CONCAT(@@sql_mode, ',ANSI'); "a"`,
+			want: []string{
+				"word:SET", "punct:@", "punct:@", "word:sql_mode", "punct:=", "word:CONCAT", "punct:(",
+				"punct:@", "punct:@", "word:sql_mode", "punct:,", "string:,ANSI", "punct:)", "punct:;",
+				"quoted:a",
+			},
+		},
+		{
+			name:   "sqlite quoting",
+			engine: engineSQLite,
+			src:    `"a" [b c] ` + "`d`" + ` 'e'`,
+			want:   []string{"quoted:a", "quoted:b c", "quoted:d", "string:e"},
+		},
+		{
+			name:   "sqlite has no hash comments or backslash escapes",
+			engine: engineSQLite,
+			src:    `# 'a\'`,
+			want:   []string{"punct:#", `string:a\`},
+		},
+	}
+	kinds := map[ddlTokenKind]string{tokWord: "word", tokQuoted: "quoted", tokString: "string", tokPunct: "punct"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toks, err := tokenizeDDL(tt.src, tt.engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tok := range toks {
+				got = append(got, kinds[tok.kind]+":"+tok.text)
+				if tok.kind != tokString && tok.kind != tokQuoted && tt.src[tok.start:tok.end] != tok.text {
+					t.Errorf("token %q spans %q", tok.text, tt.src[tok.start:tok.end])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeDDLErrors(t *testing.T) {
+	for _, src := range []string{"'open", "`open", "/* open", `"open`} {
+		if _, err := tokenizeDDL(src, engineMySQL); err == nil {
+			t.Errorf("tokenizeDDL(%q) succeeded", src)
+		}
+	}
+}
+
+// parseTestDDL parses the statements as one migration file.
+func parseTestDDL(t *testing.T, engine, src string) *Schema {
+	t.Helper()
+	s := newSchema(engine)
+	if err := parseDDL("1.sql", []byte(src), engine, s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseDDL(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine string
+		src    string
+		table  string
+		want   []string // name type flags
+	}{
+		{
+			name:   "mysql create table",
+			engine: engineMySQL,
+			src: "CREATE TABLE `users` (\n" +
+				"  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,\n" +
+				"  email VARCHAR(255) NOT NULL UNIQUE,\n" +
+				"  team_id INT REFERENCES teams(id),\n" +
+				"  bio TEXT CHARACTER SET utf8mb4,\n" +
+				"  PRIMARY KEY (id),\n" +
+				"  KEY idx_team (team_id)\n" +
+				") ENGINE=InnoDB;",
+			table: "users",
+			want: []string{
+				"id bigint unsigned PK NN",
+				"email varchar(255) UQ NN",
+				"team_id int FK:teams(id)",
+				"bio text",
+			},
+		},
+		{
+			name:   "mysql double quoted enum",
+			engine: engineMySQL,
+			src:    `CREATE TABLE shirts (size ENUM("small", "large") NOT NULL DEFAULT "small");`,
+			table:  "shirts",
+			want:   []string{"size shirts_size NN"},
+		},
+		{
+			name:   "mysql modify replaces the definition",
+			engine: engineMySQL,
+			src: "CREATE TABLE t (id INT PRIMARY KEY, name VARCHAR(10) NOT NULL, code CHAR(2) UNIQUE);\n" +
+				"ALTER TABLE t MODIFY name TEXT, MODIFY COLUMN code CHAR(3) NOT NULL;",
+			table: "t",
+			want:  []string{"id int PK", "name text", "code char(3) UQ NN"},
+		},
+		{
+			name:   "mysql change renames and replaces",
+			engine: engineMySQL,
+			src: "CREATE TABLE t (id INT, owner INT NOT NULL REFERENCES users(id));\n" +
+				"ALTER TABLE t CHANGE COLUMN owner owner_id BIGINT;",
+			table: "t",
+			want:  []string{"id int", "owner_id bigint FK:users(id)"},
+		},
+		{
+			name:   "mysql add and drop",
+			engine: engineMySQL,
+			src: "CREATE TABLE t (a INT, b INT);\n" +
+				"ALTER TABLE t ADD COLUMN c DATE, DROP COLUMN a, ADD UNIQUE KEY uq_b (b);",
+			table: "t",
+			want:  []string{"b int UQ", "c date"},
+		},
+		{
+			name:   "sqlite create table",
+			engine: engineSQLite,
+			src: `CREATE TABLE IF NOT EXISTS [posts] (
+				"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id INTEGER NOT NULL REFERENCES authors,
+				title TEXT CHECK (length(title) > 0)
+			);`,
+			table: "posts",
+			want:  []string{"id integer PK", "author_id integer NN FK:authors()", "title text"},
+		},
+		{
+			name:   "mysql drop keys",
+			engine: engineMySQL,
+			src: "CREATE TABLE t (id INT PRIMARY KEY, a INT, b INT UNIQUE, team_id INT,\n" +
+				"  CONSTRAINT fk_team FOREIGN KEY (team_id) REFERENCES teams (id), UNIQUE KEY uq_a (a));\n" +
+				"ALTER TABLE t DROP PRIMARY KEY, DROP FOREIGN KEY fk_team, DROP INDEX uq_a, DROP KEY b;",
+			table: "t",
+			want:  []string{"id int", "a int", "b int", "team_id int"},
+		},
+		{
+			name:   "sqlite column named key",
+			engine: engineSQLite,
+			src:    "CREATE TABLE kv (key TEXT PRIMARY KEY, value TEXT);",
+			table:  "kv",
+			want:   []string{"key text PK", "value text"},
+		},
+		{
+			name:   "mysql columns named key and index",
+			engine: engineMySQL,
+			src: "CREATE TABLE t (`key` VARCHAR(64) NOT NULL, index INT, KEY idx_index USING BTREE (`index`), FULLTEXT (`key`));\n" +
+				"ALTER TABLE t ADD key_id INT, ADD INDEX (key_id);",
+			table: "t",
+			want:  []string{"key varchar(64) NN", "index int", "key_id int"},
+		},
+		{
+			name:   "sqlite rename",
+			engine: engineSQLite,
+			src: "CREATE TABLE a (x INT);\n" +
+				"ALTER TABLE a RENAME COLUMN x TO y;\n" +
+				"ALTER TABLE a RENAME TO b;",
+			table: "b",
+			want:  []string{"y int"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := parseTestDDL(t, tt.engine, tt.src)
+			tbl := s.Tables[tt.table]
+			if tbl == nil {
+				t.Fatalf("no table %s in %v", tt.table, sortedKeys(s.Tables))
+			}
+			var got []string
+			for _, c := range tbl.Cols {
+				got = append(got, describeTestCol(c))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// describeTestCol sums up a column as "name type flags".
+func describeTestCol(c Column) string {
+	parts := []string{c.Name, c.Type}
+	if c.PrimaryKey {
+		parts = append(parts, "PK")
+	}
+	if c.Unique {
+		parts = append(parts, "UQ")
+	}
+	if c.NotNull {
+		parts = append(parts, "NN")
+	}
+	if fk := c.ForeignKey; fk != nil {
+		parts = append(parts, "FK:"+tableLabel(fk.DstSchema, fk.DstTable)+"("+strings.Join(fk.DstCols, ",")+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseDDLEnum(t *testing.T) {
+	s := parseTestDDL(t, engineMySQL, `CREATE TABLE users (size ENUM("small", 'medium', "x""l"));`)
+	ct := s.Types["users_size"]
+	if ct == nil {
+		t.Fatalf("no users_size enum in %v", sortedKeys(s.Types))
+	}
+	if want := []string{"small", "medium", `x"l`}; !reflect.DeepEqual(ct.Values, want) {
+		t.Errorf("values %q, want %q", ct.Values, want)
+	}
+}
+
+func TestParseDDLViews(t *testing.T) {
+	s := parseTestDDL(t, engineSQLite, "CREATE TABLE a (x INT, y INT);\n"+
+		"CREATE VIEW v AS SELECT x, y AS why, count(*) FROM a;\n"+
+		"CREATE VIEW w (p, q) AS SELECT x, y FROM a;\n"+
+		"DROP VIEW IF EXISTS w;")
+	if got := sortedKeys(s.Views); !reflect.DeepEqual(got, []string{"v"}) {
+		t.Fatalf("views %v, want [v]", got)
+	}
+	v := s.Views["v"]
+	var cols []string
+	for _, c := range v.Cols {
+		cols = append(cols, c.Name)
+	}
+	if want := []string{"x", "why", "count"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("columns %q, want %q", cols, want)
+	}
+	if want := "SELECT x, y AS why, count(*) FROM a"; v.Query != want {
+		t.Errorf("query %q, want %q", v.Query, want)
+	}
+}
+
+func TestParseDDLKeys(t *testing.T) {
+	s := parseTestDDL(t, engineMySQL, "CREATE TABLE teams (id INT PRIMARY KEY);\n"+
+		"CREATE TABLE members (team_id INT, user_id INT, UNIQUE KEY uq (team_id, user_id), FOREIGN KEY (team_id) REFERENCES teams (id));\n"+
+		"ALTER TABLE members RENAME TO team_members;")
+	tm := s.Tables["team_members"]
+	if tm == nil {
+		t.Fatalf("no team_members in %v", sortedKeys(s.Tables))
+	}
+	if want := [][]string{{"team_id", "user_id"}}; !reflect.DeepEqual(tm.Uniques, want) {
+		t.Errorf("uniques %q, want %q", tm.Uniques, want)
+	}
+	for _, c := range tm.Cols {
+		if c.Unique {
+			t.Errorf("%s is only unique together with the other column", c.Name)
+		}
+	}
+	if len(s.FKs) != 1 || s.fkOwner(s.FKs[0]) != tm {
+		t.Errorf("FKs %+v, want one declared on team_members", s.FKs)
+	}
+}
+
+func TestParseDDLDrops(t *testing.T) {
+	s := parseTestDDL(t, engineMySQL, "CREATE TABLE teams (id INT PRIMARY KEY);\n"+
+		"CREATE TABLE members (team_id INT, user_id INT, CONSTRAINT uq UNIQUE (team_id, user_id),\n"+
+		"  CONSTRAINT fk_team FOREIGN KEY (team_id) REFERENCES teams (id), CONSTRAINT positive CHECK (user_id > 0));\n"+
+		"ALTER TABLE members DROP CONSTRAINT uq, DROP FOREIGN KEY fk_team, DROP CHECK positive;")
+	m := s.Tables["members"]
+	if len(m.Uniques) != 0 || len(m.Constraints) != 0 || len(s.FKs) != 0 {
+		t.Errorf("uniques %q, constraints %+v and FKs %+v left after dropping them", m.Uniques, m.Constraints, s.FKs)
+	}
+}
+
+func TestParseDDLRenames(t *testing.T) {
+	s := parseTestDDL(t, engineMySQL, "CREATE TABLE teams (id INT PRIMARY KEY);\n"+
+		"CREATE TABLE members (team_id INT REFERENCES teams (id), user_id INT, UNIQUE KEY uq (team_id, user_id),\n"+
+		"  FOREIGN KEY (team_id) REFERENCES teams (id));\n"+
+		"ALTER TABLE teams RENAME COLUMN id TO team_id;\n"+
+		"ALTER TABLE teams RENAME TO squads;\n"+
+		"ALTER TABLE members RENAME COLUMN team_id TO squad_id;")
+	m := s.Tables["members"]
+	if want := [][]string{{"squad_id", "user_id"}}; !reflect.DeepEqual(m.Uniques, want) {
+		t.Errorf("uniques %q, want %q", m.Uniques, want)
+	}
+	if got, want := describeTestCol(m.Cols[0]), "squad_id int FK:squads(team_id)"; got != want {
+		t.Errorf("column %q, want %q", got, want)
+	}
+	want := FK{SrcTable: "members", SrcCols: []string{"squad_id"}, DstTable: "squads", DstCols: []string{"team_id"}}
+	if len(s.FKs) != 1 {
+		t.Fatalf("FKs %+v, want one", s.FKs)
+	}
+	if fk := s.FKs[0]; fk.SrcTable != want.SrcTable || !reflect.DeepEqual(fk.SrcCols, want.SrcCols) ||
+		fk.DstTable != want.DstTable || !reflect.DeepEqual(fk.DstCols, want.DstCols) {
+		t.Errorf("FK %+v, want %+v", fk, want)
+	}
+}
@@ -0,0 +1,187 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2layouts/d2elklayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+)
+
+// defaultSVG is where the SVG goes unless the options say otherwise.
+const defaultSVG = "schema.svg"
+
+// renderDiagram lays out the schema with d2 and renders the D2 source and SVG
+// outputs.
+func renderDiagram(ctx context.Context, s *Schema, usage []*queryUsage, opts Options) ([]file, error) {
+	if opts.Outputs.SVG == "" && opts.Outputs.D2 == "" && opts.Outputs.DrawIO == "" && opts.Outputs.LayoutJSON == "" && opts.Outputs.HTML == "" {
+		return nil, nil
+	}
+
+	ro := renderOptions{detail: opts.Detail, tooltips: opts.Tooltips, link: opts.expandLink}
+	if opts.QueryUsage {
+		ro.usage = usageByTable(usage)
+		ro.unused = findUnused(s, usage)
+	}
+	g, err := renderD2(s.Tables, s.FKs, s.Views, s.Types, ro)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render d2: %s", err)
+	}
+
+	c, err := compileDiagram(ctx, g, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var fs []file
+	if opts.Outputs.SVG != "" {
+		fs = append(fs, file{path: opts.Outputs.SVG, content: string(c.svg)})
+	}
+	if opts.Outputs.D2 != "" {
+		fs = append(fs, file{path: opts.Outputs.D2, content: c.d2})
+	}
+	if opts.Outputs.DrawIO != "" {
+		fs = append(fs, file{path: opts.Outputs.DrawIO, content: renderDrawIO(c.diagram)})
+	}
+	if opts.Outputs.LayoutJSON != "" {
+		content, err := renderLayoutJSON(s, c.diagram)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, file{path: opts.Outputs.LayoutJSON, content: content})
+	}
+	if opts.Outputs.HTML != "" {
+		site, err := renderSite(s, c.svg, opts.Outputs.HTML)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, site...)
+	}
+
+	return fs, nil
+}
+
+// renderDiffDiagram renders the merged schema of a diff to the D2 source and
+// SVG outputs, coloured by what changed.
+func renderDiffDiagram(ctx context.Context, s *Schema, d *schemaDiff, opts Options) ([]file, error) {
+	if opts.Outputs.SVG == "" && opts.Outputs.D2 == "" {
+		return nil, nil
+	}
+
+	ro := renderOptions{detail: opts.Detail, tooltips: opts.Tooltips, link: opts.expandLink, diff: d}
+	g, err := renderD2(s.Tables, s.FKs, s.Views, s.Types, ro)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render d2: %s", err)
+	}
+
+	c, err := compileDiagram(ctx, g, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var fs []file
+	if opts.Outputs.SVG != "" {
+		fs = append(fs, file{path: opts.Outputs.SVG, content: string(c.svg)})
+	}
+	if opts.Outputs.D2 != "" {
+		fs = append(fs, file{path: opts.Outputs.D2, content: c.d2})
+	}
+	return fs, nil
+}
+
+// renderD2 compiles the schema's D2 source to a graph. It's safe to call
+// concurrently.
+func renderD2(tables map[string]*Table, tlfk []FK, views map[string]*View, customTypes map[string]*CustomType, ro renderOptions) (*d2graph.Graph, error) {
+	src, err := renderD2Text(tables, tlfk, views, customTypes, ro)
+	if err != nil {
+		return nil, err
+	}
+	g, _, err := d2compiler.Compile("", strings.NewReader(src), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile d2: %w", err)
+	}
+	return g, nil
+}
+
+// compiled is a graph rendered every way the outputs need it.
+type compiled struct {
+	d2      string
+	diagram *d2target.Diagram // laid out
+	svg     []byte
+}
+
+// compileDiagram formats the graph as D2 source, lays it out and renders it
+// to SVG.
+func compileDiagram(ctx context.Context, g *d2graph.Graph, opts Options) (*compiled, error) {
+	gf := d2format.Format(g.AST)
+
+	diagram, themeID, err := layoutDiagram(ctx, gf, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Render diagram -> SVG bytes
+	svg, err := d2svg.Render(diagram, &d2svg.RenderOpts{
+		ThemeID: &themeID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render svg: %w", err)
+	}
+	svg = stampSVG(svg, gf, opts.Theme, opts.Layout)
+
+	return &compiled{d2: gf, diagram: diagram, svg: svg}, nil
+}
+
+// layoutDiagram compiles D2 source and lays out every board in it, returning
+// the theme to render it with.
+func layoutDiagram(ctx context.Context, src string, opts Options) (*d2target.Diagram, int64, error) {
+	ruler, err := textmeasure.NewRuler()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create text ruler: %w", err)
+	}
+	if ruler == nil {
+		return nil, 0, fmt.Errorf("text ruler was nil")
+	}
+
+	lr := func(engine string) (d2graph.LayoutGraph, error) {
+		switch engine {
+		case "elk":
+			return d2elklayout.DefaultLayout, nil
+		case "dagre":
+			return d2dagrelayout.DefaultLayout, nil
+		default:
+			return nil, fmt.Errorf("unknown layout engine: %s", engine)
+		}
+	}
+
+	theme, err := findTheme(opts.Theme)
+	if err != nil {
+		return nil, 0, err
+	}
+	themeID := theme.ID
+	// Compile D2 -> diagram
+
+	diagram, _, err := d2lib.Compile(ctx, src,
+		&d2lib.CompileOptions{
+			LayoutResolver: lr,
+			Layout:         strPtr(opts.Layout),
+			Ruler:          ruler,
+		},
+		&d2svg.RenderOpts{ThemeID: &themeID},
+	)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to compile d2: %w", err)
+	}
+	return diagram, themeID, nil
+}
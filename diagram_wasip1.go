@@ -0,0 +1,63 @@
+//go:build wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultSVG is empty in the wasm build, which can't lay the diagram out.
+const defaultSVG = ""
+
+// renderDiagram only writes the D2 source in the wasm build. d2 runs its
+// layout engines (and parts of its graph compiler) as JavaScript through goja,
+// which it doesn't build for wasip1, so nothing that needs a layout works.
+func renderDiagram(_ context.Context, s *Schema, usage []*queryUsage, opts Options) ([]file, error) {
+	if opts.Outputs.SVG != "" || opts.Outputs.DrawIO != "" || opts.Outputs.LayoutJSON != "" {
+		return nil, fmt.Errorf("svg, drawio and layout_json outputs need the native build, disable them in the plugin options")
+	}
+	var fs []file
+	if opts.Outputs.D2 != "" {
+		ro := renderOptions{detail: opts.Detail, tooltips: opts.Tooltips, link: opts.expandLink}
+		if opts.QueryUsage {
+			ro.usage = usageByTable(usage)
+			ro.unused = findUnused(s, usage)
+		}
+		src, err := renderD2Text(s.Tables, s.FKs, s.Views, s.Types, ro)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render d2: %s", err)
+		}
+		fs = append(fs, file{path: opts.Outputs.D2, content: src})
+	}
+	if opts.Outputs.HTML != "" {
+		// the site works without its diagram
+		site, err := renderSite(s, nil, opts.Outputs.HTML)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, site...)
+	}
+	return fs, nil
+}
+
+func renderQueryDiagrams(_ context.Context, _ *Schema, _ []*queryUsage, opts Options) ([]file, error) {
+	if opts.Outputs.QueryDiagrams != "" {
+		return nil, fmt.Errorf("query diagrams aren't available in the wasm build, disable them in the plugin options")
+	}
+	return nil, nil
+}
+
+func renderDiffDiagram(_ context.Context, _ *Schema, _ *schemaDiff, opts Options) ([]file, error) {
+	if opts.Outputs.SVG != "" || opts.Outputs.D2 != "" {
+		return nil, fmt.Errorf("the diff diagram isn't available in the wasm build, use -f summary")
+	}
+	return nil, nil
+}
+
+func renderTimeline(_ context.Context, _ *Schema, opts Options) ([]file, error) {
+	if opts.Outputs.Timeline != "" {
+		return nil, fmt.Errorf("the timeline isn't available in the wasm build, disable it in the plugin options")
+	}
+	return nil, nil
+}
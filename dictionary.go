@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// renderDictionary writes the schema as a Markdown data dictionary: a
+// section per table with its columns, keys and checks, then the views, enums,
+// domains and composite types.
+func renderDictionary(s *Schema) string {
+	var sb strings.Builder
+	sb.WriteString("# Data dictionary\n")
+
+	owned := map[*Table][]FK{}
+	for _, fk := range s.FKs {
+		if t := s.fkOwner(fk); t != nil {
+			owned[t] = append(owned[t], fk)
+		}
+	}
+
+	if len(s.Tables) > 0 {
+		sb.WriteString("\n## Tables\n")
+	}
+	for _, k := range sortedKeys(s.Tables) {
+		t := s.Tables[k]
+		fmt.Fprintf(&sb, "\n### %s\n\n", tableLabel(t.Schema, t.Name))
+		writeProvenance(&sb, t.Created, t.Altered)
+		history := t.Created != nil
+		if history {
+			sb.WriteString("| Column | Type | Keys | References | History |\n|---|---|---|---|---|\n")
+		} else {
+			sb.WriteString("| Column | Type | Keys | References |\n|---|---|---|---|\n")
+		}
+		for _, c := range t.Cols {
+			var keys []string
+			if c.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if c.Unique {
+				keys = append(keys, "UNQ")
+			}
+			if c.ForeignKey != nil {
+				keys = append(keys, "FK")
+			}
+			if c.NotNull && !c.PrimaryKey {
+				keys = append(keys, "NOT NULL")
+			}
+			ref := ""
+			if c.ForeignKey != nil {
+				ref = mdRef(c.ForeignKey)
+			}
+			fmt.Fprintf(&sb, "| `%s` | %s | %s | %s |", mdCell(c.Name), mdCode(c.Type), strings.Join(keys, ", "), ref)
+			if history {
+				fmt.Fprintf(&sb, " %s |", mdHistory(c.Created, c.Altered))
+			}
+			sb.WriteString("\n")
+		}
+
+		if fks := owned[t]; len(fks) > 0 {
+			sb.WriteString("\nForeign keys:\n\n")
+			for _, fk := range fks {
+				fmt.Fprintf(&sb, "- `(%s)` → %s%s\n", strings.Join(fk.SrcCols, ", "), mdRef(&fk), mdAdded(fk.Created, t.Created))
+			}
+		}
+		if len(t.Uniques) > 0 {
+			sb.WriteString("\nUnique:\n\n")
+			for _, u := range t.Uniques {
+				fmt.Fprintf(&sb, "- `(%s)`\n", strings.Join(u, ", "))
+			}
+		}
+		if len(t.Constraints) > 0 {
+			sb.WriteString("\nConstraints:\n\n")
+			for _, con := range t.Constraints {
+				name := con.Name
+				if name == "" {
+					name = strings.ToLower(con.Type)
+				}
+				fmt.Fprintf(&sb, "- `%s` %s `%s`%s\n", name, con.Type, con.Description, mdAdded(con.Created, t.Created))
+			}
+		}
+	}
+
+	if len(s.Views) > 0 {
+		sb.WriteString("\n## Views\n")
+	}
+	for _, k := range sortedKeys(s.Views) {
+		v := s.Views[k]
+		fmt.Fprintf(&sb, "\n### %s\n\n", tableLabel(v.Schema, v.Name))
+		writeProvenance(&sb, v.Created, v.Altered)
+		sb.WriteString("| Column | Type |\n|---|---|\n")
+		for _, c := range v.Cols {
+			typ := c.Type
+			if typ == "unknown" {
+				typ = ""
+			}
+			fmt.Fprintf(&sb, "| `%s` | %s |\n", mdCell(c.Name), mdCode(typ))
+		}
+	}
+
+	writeTypes := func(kind, heading string, body func(ct *CustomType)) {
+		first := true
+		for _, k := range sortedKeys(s.Types) {
+			ct := s.Types[k]
+			if ct.TypeKind != kind {
+				continue
+			}
+			if first {
+				fmt.Fprintf(&sb, "\n## %s\n", heading)
+				first = false
+			}
+			fmt.Fprintf(&sb, "\n### %s\n\n", tableLabel(ct.Schema, ct.Name))
+			writeProvenance(&sb, ct.Created, ct.Altered)
+			body(ct)
+		}
+	}
+	writeTypes("enum", "Enums", func(ct *CustomType) {
+		for _, v := range ct.Values {
+			fmt.Fprintf(&sb, "- `%s`\n", v)
+		}
+	})
+	writeTypes("domain", "Domains", func(ct *CustomType) {
+		fmt.Fprintf(&sb, "- Base type: %s\n", mdCode(ct.BaseType))
+		if ct.Check != "" {
+			fmt.Fprintf(&sb, "- Check: `%s`\n", ct.Check)
+		}
+		if ct.Default != "" {
+			fmt.Fprintf(&sb, "- Default: `%s`\n", ct.Default)
+		}
+		if ct.NotNull {
+			sb.WriteString("- Not null\n")
+		}
+	})
+	writeTypes("composite", "Composite types", func(ct *CustomType) {
+		if len(ct.Cols) == 0 {
+			sb.WriteString("No fields known.\n")
+			return
+		}
+		sb.WriteString("| Field | Type |\n|---|---|\n")
+		for _, c := range ct.Cols {
+			fmt.Fprintf(&sb, "| `%s` | %s |\n", mdCell(c.Name), mdCode(c.Type))
+		}
+	})
+
+	return sb.String()
+}
+
+// writeProvenance writes the paragraph saying where an object was created
+// and altered, if that's known.
+func writeProvenance(sb *strings.Builder, created *Location, altered []*Location) {
+	if created == nil && len(altered) == 0 {
+		return
+	}
+	var parts []string
+	if created != nil {
+		parts = append(parts, "Created in "+mdLocation(created))
+	}
+	if len(altered) > 0 {
+		parts = append(parts, "altered in "+mdLocations(altered))
+	}
+	parts[0] = strings.ToUpper(parts[0][:1]) + parts[0][1:]
+	fmt.Fprintf(sb, "%s.\n\n", strings.Join(parts, ", "))
+}
+
+// mdHistory is a column's History cell.
+func mdHistory(created *Location, altered []*Location) string {
+	var parts []string
+	if created != nil {
+		parts = append(parts, "created "+mdLocation(created))
+	}
+	if len(altered) > 0 {
+		parts = append(parts, "altered "+mdLocations(altered))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// mdAdded notes when a key or constraint came after its table.
+func mdAdded(loc, tableCreated *Location) string {
+	if loc == nil || tableCreated != nil && *loc == *tableCreated {
+		return ""
+	}
+	return ", added in " + mdLocation(loc)
+}
+
+func mdLocation(loc *Location) string {
+	return mdCode(loc.String())
+}
+
+func mdLocations(locs []*Location) string {
+	out := make([]string, len(locs))
+	for i, l := range locs {
+		out[i] = mdLocation(l)
+	}
+	return strings.Join(out, ", ")
+}
+
+var mdAnchorStrip = regexp.MustCompile(`[^a-z0-9_\- ]`)
+
+// mdAnchor is the anchor GitHub generates for a heading.
+func mdAnchor(heading string) string {
+	return strings.ReplaceAll(mdAnchorStrip.ReplaceAllString(strings.ToLower(heading), ""), " ", "-")
+}
+
+// mdRef links to the referenced table's section.
+func mdRef(fk *FK) string {
+	label := tableLabel(fk.DstSchema, fk.DstTable)
+	text := label
+	if len(fk.DstCols) > 0 {
+		text += "." + strings.Join(fk.DstCols, ", ")
+	}
+	return fmt.Sprintf("[`%s`](#%s)", mdCell(text), mdAnchor(label))
+}
+
+func mdCode(s string) string {
+	s = strings.TrimPrefix(s, "pg_catalog.")
+	if s == "" {
+		return ""
+	}
+	return "`" + mdCell(s) + "`"
+}
+
+// mdCell escapes pipes, which would end a table cell.
+func mdCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDictionary(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+`
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+CREATE DOMAIN pos AS int CHECK (VALUE > 0);
+CREATE TYPE pair AS (a int, "b|c" text);
+ALTER TABLE users ADD CONSTRAINT email_len CHECK (length(email) < 100);
+CREATE VIEW v AS SELECT id FROM users;
+`)
+	md := renderDictionary(s)
+
+	for _, block := range []string{
+		"| `user_id` | `int4` | UNQ, FK | [`users.id`](#users) | created `1.sql:4` |\n",
+		"| `name` | `text` | NOT NULL |  | created `1.sql:2` |\n",
+		"Foreign keys:\n\n- `(user_id)` → [`users.id`](#users)\n\nUnique:\n\n- `(project_id, user_id)`\n",
+		"Constraints:\n\n- `email_len` CHECK `length(email) < 100`, added in `1.sql:17`\n",
+		"## Views\n\n### v\n\nCreated in `1.sql:18`.\n\n| Column | Type |\n|---|---|\n| `id` |  |\n",
+		"## Enums\n\n### mood\n\nCreated in `1.sql:14`.\n\n- `sad`\n- `happy`\n",
+		"- Base type: `int4`\n- Check: `value > 0`\n",
+		"| `b\\|c` | `text` |\n",
+	} {
+		if !strings.Contains(md, block) {
+			t.Errorf("dictionary is missing\n%s\nin:\n%s", block, md)
+		}
+	}
+
+	// tables in key order, before the views and types
+	var headings []string
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(line, "#") {
+			headings = append(headings, line)
+		}
+	}
+	want := "# Data dictionary,## Tables,### audit,### profiles,### project_members,### projects,### users," +
+		"## Views,### v,## Enums,### mood,## Domains,### pos,## Composite types,### pair"
+	if got := strings.Join(headings, ","); got != want {
+		t.Errorf("headings\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestMDAnchor(t *testing.T) {
+	for heading, want := range map[string]string{
+		"users":        "users",
+		"audit.events": "auditevents",
+		"My Table_2":   "my-table_2",
+		"a-b (c)":      "a-b-c",
+	} {
+		if got := mdAnchor(heading); got != want {
+			t.Errorf("mdAnchor(%q) = %q, want %q", heading, got, want)
+		}
+	}
+}
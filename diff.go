@@ -0,0 +1,565 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// schemaDiff is what changed between two schemas, object by object.
+type schemaDiff struct {
+	Tables []objectChange
+	Views  []objectChange
+	Types  []objectChange
+
+	// by Schema map key, for the renderer
+	tables, views, types map[string]*objectChange
+	// table-level FK changes by fkID
+	fks map[string]string
+}
+
+// objectChange is an added, removed or changed table, view or type.
+type objectChange struct {
+	Key    string
+	Label  string
+	Kind   string // table, view, enum, domain or composite
+	Change string
+	// Columns lists the changed columns of a changed table, view or
+	// composite type.
+	Columns []columnChange
+	// Constraints and FKs list a changed table's changed table constraints
+	// and table-level foreign keys.
+	Constraints []constraintChange
+	FKs         []fkChange
+	// AddedValues and RemovedValues are a changed enum's.
+	AddedValues, RemovedValues []string
+	// Redefined is set when a changed view's query changed.
+	Redefined bool
+	// Details are the other changes to a changed type, in words.
+	Details []string
+}
+
+type columnChange struct {
+	Name   string
+	Change string
+	Old    *Column // nil when added
+	New    *Column // nil when removed
+}
+
+// constraintChange is a constraint added or removed, or a named one whose
+// definition changed.
+type constraintChange struct {
+	Change string
+	Old    *TableConstraint // nil when added
+	New    *TableConstraint // nil when removed
+}
+
+type fkChange struct {
+	Change string
+	FK     FK
+}
+
+// diffSchemas compares two schemas.
+func diffSchemas(old, cur *Schema) *schemaDiff {
+	d := &schemaDiff{
+		tables: map[string]*objectChange{},
+		views:  map[string]*objectChange{},
+		types:  map[string]*objectChange{},
+		fks:    map[string]string{},
+	}
+
+	oldFKs, curFKs := ownedFKs(old), ownedFKs(cur)
+	for _, k := range unionKeys(old.Tables, cur.Tables) {
+		o, n := old.Tables[k], cur.Tables[k]
+		var c objectChange
+		switch {
+		case o == nil:
+			c = objectChange{Label: tableLabel(n.Schema, n.Name), Change: changeAdded}
+			for _, fk := range curFKs[k] {
+				d.fks[fkID(k, fk)] = changeAdded
+			}
+		case n == nil:
+			c = objectChange{Label: tableLabel(o.Schema, o.Name), Change: changeRemoved}
+			for _, fk := range oldFKs[k] {
+				d.fks[fkID(k, fk)] = changeRemoved
+			}
+		default:
+			c = objectChange{Label: tableLabel(n.Schema, n.Name), Change: changeChanged}
+			c.Columns = diffColumns(o.Cols, n.Cols)
+			c.Constraints = diffConstraints(withUniques(o), withUniques(n))
+			for _, fk := range oldFKs[k] {
+				if !slices.ContainsFunc(curFKs[k], fk.same) {
+					c.FKs = append(c.FKs, fkChange{Change: changeRemoved, FK: *fk})
+					d.fks[fkID(k, fk)] = changeRemoved
+				}
+			}
+			for _, fk := range curFKs[k] {
+				if !slices.ContainsFunc(oldFKs[k], fk.same) {
+					c.FKs = append(c.FKs, fkChange{Change: changeAdded, FK: *fk})
+					d.fks[fkID(k, fk)] = changeAdded
+				}
+			}
+			if len(c.Columns) == 0 && len(c.Constraints) == 0 && len(c.FKs) == 0 {
+				continue
+			}
+		}
+		c.Key, c.Kind = k, "table"
+		d.Tables = append(d.Tables, c)
+	}
+
+	for _, k := range unionKeys(old.Views, cur.Views) {
+		o, n := old.Views[k], cur.Views[k]
+		var c objectChange
+		switch {
+		case o == nil:
+			c = objectChange{Label: tableLabel(n.Schema, n.Name), Change: changeAdded}
+		case n == nil:
+			c = objectChange{Label: tableLabel(o.Schema, o.Name), Change: changeRemoved}
+		default:
+			c = objectChange{Label: tableLabel(n.Schema, n.Name), Change: changeChanged}
+			c.Columns = diffColumns(o.Cols, n.Cols)
+			c.Redefined = o.Query != n.Query
+			if len(c.Columns) == 0 && !c.Redefined {
+				continue
+			}
+		}
+		c.Key, c.Kind = k, "view"
+		d.Views = append(d.Views, c)
+	}
+
+	for _, k := range unionKeys(old.Types, cur.Types) {
+		o, n := old.Types[k], cur.Types[k]
+		var c objectChange
+		switch {
+		case o == nil:
+			c = objectChange{Label: tableLabel(n.Schema, n.Name), Kind: n.TypeKind, Change: changeAdded}
+		case n == nil:
+			c = objectChange{Label: tableLabel(o.Schema, o.Name), Kind: o.TypeKind, Change: changeRemoved}
+		default:
+			c = objectChange{Label: tableLabel(n.Schema, n.Name), Kind: n.TypeKind, Change: changeChanged, Details: diffTypes(o, n)}
+			c.Columns = diffColumns(o.Cols, n.Cols)
+			if o.TypeKind == n.TypeKind {
+				c.AddedValues = missing(n.Values, o.Values)
+				c.RemovedValues = missing(o.Values, n.Values)
+			}
+			if len(c.Columns) == 0 && len(c.Details) == 0 && len(c.AddedValues) == 0 && len(c.RemovedValues) == 0 {
+				continue
+			}
+		}
+		c.Key = k
+		d.Types = append(d.Types, c)
+	}
+
+	for i := range d.Tables {
+		d.tables[d.Tables[i].Key] = &d.Tables[i]
+	}
+	for i := range d.Views {
+		d.views[d.Views[i].Key] = &d.Views[i]
+	}
+	for i := range d.Types {
+		d.types[d.Types[i].Key] = &d.Types[i]
+	}
+	return d
+}
+
+// empty reports whether the schemas were the same.
+func (d *schemaDiff) empty() bool {
+	return len(d.Tables) == 0 && len(d.Views) == 0 && len(d.Types) == 0
+}
+
+// The lookups below return how an object changed, "" if it didn't. They're
+// safe to call on a nil diff.
+
+func (d *schemaDiff) table(k string) string {
+	if d == nil || d.tables[k] == nil {
+		return ""
+	}
+	return d.tables[k].Change
+}
+
+func (d *schemaDiff) view(k string) string {
+	if d == nil || d.views[k] == nil {
+		return ""
+	}
+	return d.views[k].Change
+}
+
+func (d *schemaDiff) customType(k string) string {
+	if d == nil || d.types[k] == nil {
+		return ""
+	}
+	return d.types[k].Change
+}
+
+// column is how a changed table's column changed. The columns of added and
+// removed tables don't count, their table says it for them.
+func (d *schemaDiff) column(table, col string) string {
+	if d == nil || d.tables[table] == nil {
+		return ""
+	}
+	if cc := d.tables[table].column(col); cc != nil {
+		return cc.Change
+	}
+	return ""
+}
+
+// oldType is a changed column's type before, if that changed.
+func (d *schemaDiff) oldType(table, col string) string {
+	if d == nil || d.tables[table] == nil {
+		return ""
+	}
+	cc := d.tables[table].column(col)
+	if cc == nil || cc.Change != changeChanged || cc.Old.Type == cc.New.Type {
+		return ""
+	}
+	return cc.Old.Type
+}
+
+// columnFK is how a column's foreign key changed, along with its table or
+// column. A column that points somewhere new counts as adding it.
+func (d *schemaDiff) columnFK(table, col string) string {
+	if change := d.table(table); change != changeChanged {
+		return change
+	}
+	change := d.column(table, col)
+	if change != changeChanged {
+		return change
+	}
+	cc := d.tables[table].column(col)
+	if cc.Old.ForeignKey.same(cc.New.ForeignKey) {
+		return ""
+	}
+	return changeAdded
+}
+
+// fk is how a table-level foreign key on a table changed.
+func (d *schemaDiff) fk(table string, fk FK) string {
+	if d == nil {
+		return ""
+	}
+	return d.fks[fkID(table, &fk)]
+}
+
+func (c *objectChange) column(name string) *columnChange {
+	for i := range c.Columns {
+		if c.Columns[i].Name == name {
+			return &c.Columns[i]
+		}
+	}
+	return nil
+}
+
+func fkID(table string, fk *FK) string {
+	return fmt.Sprintf("%s(%s)->%s(%s)", table, strings.Join(fk.SrcCols, ","), key(fk.DstSchema, fk.DstTable), strings.Join(fk.DstCols, ","))
+}
+
+func diffColumns(old, cur []Column) []columnChange {
+	var out []columnChange
+	for i := range old {
+		if findColumn(cur, old[i].Name) == nil {
+			out = append(out, columnChange{Name: old[i].Name, Change: changeRemoved, Old: &old[i]})
+		}
+	}
+	for i := range cur {
+		o := findColumn(old, cur[i].Name)
+		switch {
+		case o == nil:
+			out = append(out, columnChange{Name: cur[i].Name, Change: changeAdded, New: &cur[i]})
+		case o.Type != cur[i].Type || o.PrimaryKey != cur[i].PrimaryKey || o.Unique != cur[i].Unique ||
+			o.NotNull != cur[i].NotNull || !o.ForeignKey.same(cur[i].ForeignKey):
+			out = append(out, columnChange{Name: cur[i].Name, Change: changeChanged, Old: o, New: &cur[i]})
+		}
+	}
+	return out
+}
+
+func findColumn(cols []Column, name string) *Column {
+	for i := range cols {
+		if cols[i].Name == name {
+			return &cols[i]
+		}
+	}
+	return nil
+}
+
+// details describes what changed about a changed column.
+func (cc columnChange) details() []string {
+	o, n := cc.Old, cc.New
+	var out []string
+	if o.Type != n.Type {
+		out = append(out, fmt.Sprintf("type %s → %s", mdCode(o.Type), mdCode(n.Type)))
+	}
+	out = append(out, cc.flags()...)
+	if !o.ForeignKey.same(n.ForeignKey) {
+		switch {
+		case n.ForeignKey == nil:
+			out = append(out, "no longer references "+mdCode(tableLabel(o.ForeignKey.DstSchema, o.ForeignKey.DstTable)))
+		default:
+			out = append(out, "references "+mdCode(tableLabel(n.ForeignKey.DstSchema, n.ForeignKey.DstTable)))
+		}
+	}
+	return out
+}
+
+// flags describes the changes to a changed column's keys and nullability.
+func (cc columnChange) flags() []string {
+	o, n := cc.Old, cc.New
+	var out []string
+	flag := func(was, is bool, what string) {
+		switch {
+		case is && !was:
+			out = append(out, "now "+what)
+		case was && !is:
+			out = append(out, "no longer "+what)
+		}
+	}
+	flag(o.PrimaryKey, n.PrimaryKey, "primary key")
+	flag(o.Unique, n.Unique, "unique")
+	flag(o.NotNull, n.NotNull, "not null")
+	return out
+}
+
+// lines describes what changed about a changed object besides its columns.
+func (c objectChange) lines() []string {
+	var out []string
+	for _, cc := range c.Constraints {
+		switch cc.Change {
+		case changeChanged:
+			out = append(out, fmt.Sprintf("changed %s: %s → %s", cc.New.describe(), mdCode(cc.Old.Description), mdCode(cc.New.Description)))
+		case changeAdded:
+			out = append(out, "added "+cc.New.describe())
+		default:
+			out = append(out, "removed "+cc.Old.describe())
+		}
+	}
+	for _, fc := range c.FKs {
+		out = append(out, fc.Change+" "+fc.FK.describe())
+	}
+	for _, v := range c.AddedValues {
+		out = append(out, "added value "+mdCode(v))
+	}
+	for _, v := range c.RemovedValues {
+		out = append(out, "removed value "+mdCode(v))
+	}
+	if c.Redefined {
+		out = append(out, "changed query")
+	}
+	return append(out, c.Details...)
+}
+
+// diffConstraints pairs constraints up by name, or by definition when they
+// have none.
+func diffConstraints(old, cur []TableConstraint) []constraintChange {
+	var out []constraintChange
+	matches := func(a, b TableConstraint) bool {
+		if a.Name != "" || b.Name != "" {
+			return a.Name == b.Name && a.Type == b.Type
+		}
+		return a.Type == b.Type && a.Description == b.Description
+	}
+	for i := range old {
+		if !slices.ContainsFunc(cur, func(c TableConstraint) bool { return matches(old[i], c) }) {
+			out = append(out, constraintChange{Change: changeRemoved, Old: &old[i]})
+		}
+	}
+	for i := range cur {
+		j := slices.IndexFunc(old, func(c TableConstraint) bool { return matches(c, cur[i]) })
+		switch {
+		case j < 0:
+			out = append(out, constraintChange{Change: changeAdded, New: &cur[i]})
+		case old[j].Description != cur[i].Description:
+			out = append(out, constraintChange{Change: changeChanged, Old: &old[j], New: &cur[i]})
+		}
+	}
+	return out
+}
+
+// withUniques is a table's constraints plus its multi-column unique ones,
+// which diff the same way.
+func withUniques(t *Table) []TableConstraint {
+	out := slices.Clone(t.Constraints)
+	for _, u := range t.Uniques {
+		out = append(out, TableConstraint{Type: "UNIQUE", Description: "(" + strings.Join(u, ", ") + ")"})
+	}
+	return out
+}
+
+// missing are the values in a that b doesn't have.
+func missing(a, b []string) []string {
+	var out []string
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// diffTypes describes what changed about a type other than its fields and
+// enum values.
+func diffTypes(o, n *CustomType) []string {
+	var out []string
+	if o.TypeKind != n.TypeKind {
+		return []string{fmt.Sprintf("kind %s → %s", o.TypeKind, n.TypeKind)}
+	}
+	if o.BaseType != n.BaseType {
+		out = append(out, fmt.Sprintf("base type %s → %s", mdCode(o.BaseType), mdCode(n.BaseType)))
+	}
+	if o.Check != n.Check {
+		out = append(out, "changed check")
+	}
+	if o.NotNull != n.NotNull {
+		out = append(out, "changed not null")
+	}
+	return out
+}
+
+func (c TableConstraint) describe() string {
+	if c.Name != "" {
+		return fmt.Sprintf("%s %s", strings.ToLower(c.Type), mdCode(c.Name))
+	}
+	return fmt.Sprintf("%s %s", strings.ToLower(c.Type), mdCode(c.Description))
+}
+
+func (fk *FK) same(o *FK) bool {
+	if fk == nil || o == nil {
+		return fk == o
+	}
+	return slices.Equal(fk.SrcCols, o.SrcCols) && fk.DstSchema == o.DstSchema && fk.DstTable == o.DstTable && slices.Equal(fk.DstCols, o.DstCols)
+}
+
+func (fk FK) describe() string {
+	return fmt.Sprintf("foreign key %s → %s", mdCode("("+strings.Join(fk.SrcCols, ", ")+")"), mdCode(tableLabel(fk.DstSchema, fk.DstTable)))
+}
+
+// ownedFKs groups the table-level FKs by the key of the table they're on.
+func ownedFKs(s *Schema) map[string][]*FK {
+	out := map[string][]*FK{}
+	for i := range s.FKs {
+		if t := s.fkOwner(s.FKs[i]); t != nil {
+			k := key(t.Schema, t.Name)
+			out[k] = append(out[k], &s.FKs[i])
+		}
+	}
+	return out
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	m := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		m[k] = true
+	}
+	for k := range b {
+		m[k] = true
+	}
+	return sortedKeys(m)
+}
+
+// mergeSchemas is the new schema plus everything the diff says was removed
+// from the old one, for drawing both in one diagram. Removed columns go at
+// the end of their table.
+func mergeSchemas(old, cur *Schema, d *schemaDiff) *Schema {
+	m := cloneSchema(cur)
+	removed := cloneSchema(old)
+	oldFKs := ownedFKs(removed)
+	for _, c := range d.Tables {
+		switch c.Change {
+		case changeRemoved:
+			m.Tables[c.Key] = removed.Tables[c.Key]
+			for _, fk := range oldFKs[c.Key] {
+				m.FKs = append(m.FKs, *fk)
+			}
+		case changeChanged:
+			for _, cc := range c.Columns {
+				if cc.Change == changeRemoved {
+					m.Tables[c.Key].Cols = append(m.Tables[c.Key].Cols, *cc.Old)
+				}
+			}
+			for _, fk := range oldFKs[c.Key] {
+				if d.fks[fkID(c.Key, fk)] == changeRemoved {
+					m.FKs = append(m.FKs, *fk)
+				}
+			}
+		}
+	}
+	for _, c := range d.Views {
+		if c.Change == changeRemoved {
+			m.Views[c.Key] = removed.Views[c.Key]
+		}
+	}
+	for _, c := range d.Types {
+		if c.Change == changeRemoved {
+			m.Types[c.Key] = removed.Types[c.Key]
+		}
+	}
+	return m
+}
+
+// counts sums the diff up in a sentence, like "1 table added, 2 tables
+// changed".
+func (d *schemaDiff) counts() string {
+	var counts []string
+	for _, g := range []struct {
+		noun    string
+		changes []objectChange
+	}{{"table", d.Tables}, {"view", d.Views}, {"type", d.Types}} {
+		n := map[string]int{}
+		for _, c := range g.changes {
+			n[c.Change]++
+		}
+		for _, change := range []string{changeAdded, changeRemoved, changeChanged} {
+			if n[change] > 0 {
+				counts = append(counts, plural(n[change], g.noun)+" "+change)
+			}
+		}
+	}
+	return strings.Join(counts, ", ")
+}
+
+// renderDiffSummary writes the diff as Markdown, object by object.
+func renderDiffSummary(d *schemaDiff) string {
+	var sb strings.Builder
+	sb.WriteString("# Schema changes\n\n")
+	if d.empty() {
+		sb.WriteString("No changes.\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%s.\n", d.counts())
+
+	section := func(heading string, changes []objectChange) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n", heading)
+		for _, c := range changes {
+			kind := ""
+			if c.Kind != "table" && c.Kind != "view" {
+				kind = " (" + c.Kind + ")"
+			}
+			fmt.Fprintf(&sb, "- **%s** %s%s\n", c.Change, mdCode(c.Label), kind)
+			for _, cc := range c.Columns {
+				switch cc.Change {
+				case changeAdded:
+					fmt.Fprintf(&sb, "  - added column %s %s\n", mdCode(cc.Name), mdCode(cc.New.Type))
+				case changeRemoved:
+					fmt.Fprintf(&sb, "  - removed column %s\n", mdCode(cc.Name))
+				default:
+					fmt.Fprintf(&sb, "  - %s: %s\n", mdCode(cc.Name), strings.Join(cc.details(), ", "))
+				}
+			}
+			for _, line := range c.lines() {
+				fmt.Fprintf(&sb, "  - %s\n", line)
+			}
+		}
+	}
+	section("Tables", d.Tables)
+	section("Views", d.Views)
+	section("Types", d.Types)
+	return sb.String()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	old := parseTestSQL(t, `
+CREATE TYPE mood AS ENUM ('sad', 'ok');
+CREATE TABLE users (id int PRIMARY KEY, email text, nick text, CONSTRAINT email_len CHECK (length(email) < 100));
+CREATE TABLE posts (id int, user_id int, title text, FOREIGN KEY (user_id) REFERENCES users(id));
+CREATE TABLE gone (id int);
+CREATE VIEW v AS SELECT id FROM users WHERE id > 1;
+CREATE VIEW w AS SELECT id FROM users;
+`)
+	cur := parseTestSQL(t, `
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+CREATE TABLE users (id bigint PRIMARY KEY, email text NOT NULL, m mood, CONSTRAINT email_len CHECK (length(email) < 200));
+CREATE TABLE posts (id int, user_id int, title text, UNIQUE (user_id, title));
+CREATE TABLE fresh (id int);
+CREATE VIEW v AS SELECT id FROM users WHERE id > 2;
+CREATE VIEW w AS SELECT id FROM users;
+`)
+	want := "# Schema changes\n\n" +
+		"1 table added, 1 table removed, 2 tables changed, 1 view changed, 1 type changed.\n\n" +
+		"## Tables\n\n" +
+		"- **added** `fresh`\n" +
+		"- **removed** `gone`\n" +
+		"- **changed** `posts`\n" +
+		"  - added unique `(user_id, title)`\n" +
+		"  - removed foreign key `(user_id)` → `users`\n" +
+		"- **changed** `users`\n" +
+		"  - removed column `nick`\n" +
+		"  - `id`: type `int4` → `int8`\n" +
+		"  - `email`: now not null\n" +
+		"  - added column `m` `mood`\n" +
+		"  - changed check `email_len`: `length(email) < 100` → `length(email) < 200`\n\n" +
+		"## Views\n\n" +
+		"- **changed** `v`\n" +
+		"  - changed query\n\n" +
+		"## Types\n\n" +
+		"- **changed** `mood` (enum)\n" +
+		"  - added value `happy`\n" +
+		"  - removed value `ok`\n"
+	if got := renderDiffSummary(diffSchemas(old, cur)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := renderDiffSummary(diffSchemas(old, old)); got != "# Schema changes\n\nNo changes.\n" {
+		t.Errorf("diffing a schema with itself gave:\n%s", got)
+	}
+}
+
+func TestDiffRedefinedView(t *testing.T) {
+	old := parseTestSQL(t, "CREATE TABLE users (id int, active bool);\nCREATE VIEW active_users AS SELECT id FROM users;")
+	cur := parseTestSQL(t, "CREATE TABLE users (id int, active bool);\nCREATE VIEW active_users AS SELECT id FROM users WHERE active;")
+	if got, want := cur.Views["active_users"].Query, "SELECT id FROM users WHERE active"; got != want {
+		t.Fatalf("query %q, want %q", got, want)
+	}
+
+	d := diffSchemas(old, cur)
+	if len(d.Tables) != 0 || len(d.Views) != 1 {
+		t.Fatalf("got %d table and %d view changes, want only the view", len(d.Tables), len(d.Views))
+	}
+	v := d.Views[0]
+	if v.Change != changeChanged || !v.Redefined || len(v.Columns) != 0 {
+		t.Errorf("got %+v, want a redefined view with the same columns", v)
+	}
+	if got := d.view("active_users"); got != changeChanged {
+		t.Errorf("renderer sees the view as %q", got)
+	}
+}
+
+// alterMigrations are 1.sql, 2.sql and 3.sql, which retype, rename and drop
+// what the first one creates.
+var alterMigrations = []string{`
+CREATE TABLE users (id int PRIMARY KEY, name text, CONSTRAINT name_len CHECK (length(name) < 50));
+CREATE TABLE posts (id int PRIMARY KEY, author int, editor int REFERENCES users(id), CONSTRAINT posts_author_fk FOREIGN KEY (author) REFERENCES users(id));
+`, `
+ALTER TABLE users ALTER COLUMN name TYPE varchar(40);
+ALTER TABLE users RENAME COLUMN id TO user_id;
+ALTER TABLE users DROP CONSTRAINT name_len;
+ALTER TABLE posts DROP CONSTRAINT posts_author_fk;
+ALTER TABLE posts ADD CONSTRAINT positive CHECK (id > 0);
+ALTER TABLE posts DROP CONSTRAINT positive;
+`, `
+ALTER TABLE posts RENAME TO articles;
+ALTER TABLE articles DROP CONSTRAINT posts_pkey;
+`}
+
+// writeAlterMigrations writes alterMigrations into dir and lists them.
+func writeAlterMigrations(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	for i, sql := range alterMigrations {
+		p := filepath.Join(dir, fmt.Sprintf("%d.sql", i+1))
+		if err := os.WriteFile(p, []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, p)
+	}
+	return files
+}
+
+// alterSummary is the summary of what 2.sql of alterMigrations changes.
+const alterSummary = "# Schema changes\n\n" +
+	"2 tables changed.\n\n" +
+	"## Tables\n\n" +
+	"- **changed** `posts`\n" +
+	"  - `editor`: references `users`\n" +
+	"  - removed foreign key `(author)` → `users`\n" +
+	"- **changed** `users`\n" +
+	"  - removed column `id`\n" +
+	"  - added column `user_id` `int4`\n" +
+	"  - `name`: type `text` → `varchar(40)`\n" +
+	"  - removed check `name_len`\n"
+
+func TestDiffUntil(t *testing.T) {
+	files := writeAlterMigrations(t, t.TempDir())
+	parse := func(until string) *Schema {
+		s, err := parseMigrations(slices.Clone(files), enginePostgreSQL, until, os.ReadFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if got := renderDiffSummary(diffSchemas(parse("1"), parse("2"))); got != alterSummary {
+		t.Errorf("1..2 got:\n%s\nwant:\n%s", got, alterSummary)
+	}
+
+	s := parse("3")
+	if s.Tables["posts"] != nil || s.Tables["articles"] == nil {
+		t.Fatalf("tables %v, want posts renamed to articles", sortedKeys(s.Tables))
+	}
+	for _, c := range s.Tables["articles"].Cols {
+		if c.PrimaryKey {
+			t.Errorf("articles.%s is still a primary key after dropping posts_pkey", c.Name)
+		}
+	}
+	if got, want := describeTestCol(s.Tables["articles"].Cols[2]), "editor int4 FK:users(user_id)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDiffBase(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	files := writeAlterMigrations(t, dir)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "1.sql"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(files[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	baseFiles, read, err := gitMigrations(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := parseMigrations(baseFiles, enginePostgreSQL, "", read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := parseMigrations(walkMigrations([]string{dir}), enginePostgreSQL, "", os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := renderDiffSummary(diffSchemas(old, cur)); got != alterSummary {
+		t.Errorf("got:\n%s\nwant:\n%s", got, alterSummary)
+	}
+}
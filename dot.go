@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// renderDOT writes the schema as a Graphviz digraph. Tables and views are
+// HTML-like table nodes with a port per column so foreign key edges land on
+// the columns they reference. Views are dashed.
+func renderDOT(s *Schema) string {
+	var sb strings.Builder
+	sb.WriteString("digraph schema {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=plaintext, fontname=\"Helvetica\"];\n")
+	sb.WriteString("  edge [dir=both, arrowhead=tee, arrowtail=crow];\n\n")
+
+	for _, k := range sortedKeys(s.Tables) {
+		t := s.Tables[k]
+		writeDOTNode(&sb, tableLabel(t.Schema, t.Name), t.Cols, false)
+	}
+	for _, k := range sortedKeys(s.Views) {
+		v := s.Views[k]
+		writeDOTNode(&sb, tableLabel(v.Schema, v.Name), v.Cols, true)
+	}
+
+	if rels := s.relations(); len(rels) > 0 {
+		sb.WriteString("\n")
+		for _, r := range rels {
+			from, to := tableLabel(r.From.Schema, r.From.Name), tableLabel(r.To.Schema, r.To.Name)
+			attrs := ""
+			if r.Unique {
+				attrs = " [arrowtail=tee]"
+			}
+			for i, c := range r.FromCols {
+				dst := fmt.Sprintf("%q", to)
+				if i < len(r.ToCols) {
+					dst += fmt.Sprintf(":%q", r.ToCols[i])
+				}
+				fmt.Fprintf(&sb, "  %q:%q -> %s%s;\n", from, c, dst, attrs)
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func writeDOTNode(sb *strings.Builder, label string, cols []Column, view bool) {
+	style := ""
+	if view {
+		style = ` style="dashed"`
+	}
+	fmt.Fprintf(sb, "  %q [label=<<table border=\"1\" cellborder=\"0\" cellspacing=\"0\"%s>", label, style)
+	fmt.Fprintf(sb, "<tr><td bgcolor=\"lightgrey\"><b>%s</b></td></tr>", html.EscapeString(label))
+	for _, c := range cols {
+		text := c.Name
+		if typ := strings.TrimPrefix(c.Type, "pg_catalog."); typ != "" && typ != "unknown" {
+			text += " " + typ
+		}
+		var keys []string
+		if c.PrimaryKey {
+			keys = append(keys, "PK")
+		}
+		if c.Unique {
+			keys = append(keys, "UNQ")
+		}
+		if c.ForeignKey != nil {
+			keys = append(keys, "FK")
+		}
+		if len(keys) > 0 {
+			text += " " + strings.Join(keys, " ")
+		}
+		fmt.Fprintf(sb, "<tr><td port=\"%s\" align=\"left\">%s</td></tr>", html.EscapeString(c.Name), html.EscapeString(text))
+	}
+	sb.WriteString("</table>>];\n")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDOT(t *testing.T) {
+	got := renderDOT(parseTestSQL(t, membersSQL))
+	for _, want := range []string{
+		`"profiles" [label=<<table border="1" cellborder="0" cellspacing="0"><tr><td bgcolor="lightgrey"><b>profiles</b></td></tr><tr><td port="user_id" align="left">user_id int4 UNQ FK</td></tr>`,
+		// one-to-one ends in a tee instead of a crow's foot
+		`"profiles":"user_id" -> "users":"id" [arrowtail=tee];`,
+		`"project_members":"project_id" -> "projects":"id";`,
+		`"project_members":"user_id" -> "users":"id";`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `"audit":"user_id" ->`) {
+		t.Errorf("the FK on project_members was drawn from audit:\n%s", got)
+	}
+}
+
+func TestRenderDOTViews(t *testing.T) {
+	got := renderDOT(parseTestSQL(t, `
+CREATE TABLE "a<b>" (id int);
+CREATE VIEW v AS SELECT id FROM "a<b>";
+`))
+	for _, want := range []string{
+		`<b>a&lt;b&gt;</b>`,
+		`"v" [label=<<table border="1" cellborder="0" cellspacing="0" style="dashed">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+}
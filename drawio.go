@@ -0,0 +1,114 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+const (
+	drawioTableStyle = "swimlane;fontStyle=1;childLayout=stackLayout;horizontal=1;startSize=%d;horizontalStack=0;resizeParent=1;resizeLast=0;collapsible=1;marginBottom=0;html=1;"
+	drawioRowStyle   = "text;strokeColor=none;fillColor=none;align=left;verticalAlign=middle;spacingLeft=4;spacingRight=4;overflow=hidden;rotatable=0;points=[[0,0.5],[1,0.5]];portConstraint=eastwest;html=1;"
+	drawioGroupStyle = "rounded=0;whiteSpace=wrap;html=1;fillColor=none;verticalAlign=top;align=left;spacingLeft=8;fontStyle=1;"
+	drawioEdgeStyle  = "edgeStyle=none;html=1;rounded=0;endArrow=ERmandOne;startArrow=ERmany;endFill=0;startFill=0;"
+)
+
+// renderDrawIO translates the laid out d2 diagram into a diagrams.net file,
+// keeping d2's positions and edge routes. Tables become entity shapes with a
+// row per column, every other shape (the views, enums, ... groups) a plain
+// box. Every cell is placed at the top level with absolute coordinates.
+func renderDrawIO(d *d2target.Diagram) string {
+	var sb strings.Builder
+	sb.WriteString(`<mxfile host="sqlc-viz-plugin">` + "\n")
+	sb.WriteString(`  <diagram id="schema" name="schema">` + "\n")
+	sb.WriteString(`    <mxGraphModel grid="1" gridSize="10" guides="1" tooltips="1" connect="1" arrows="1" fold="1" page="0">` + "\n")
+	sb.WriteString("      <root>\n")
+	sb.WriteString(`        <mxCell id="0" />` + "\n")
+	sb.WriteString(`        <mxCell id="1" parent="0" />` + "\n")
+
+	ids := make(map[string]string, len(d.Shapes))
+	for i, s := range d.Shapes {
+		id := fmt.Sprintf("s%d", i)
+		ids[s.ID] = id
+
+		style := drawioGroupStyle
+		if s.Type == d2target.ShapeSQLTable {
+			style = fmt.Sprintf(drawioTableStyle, drawioRowHeight(s))
+		}
+		if s.StrokeDash > 0 {
+			style += "dashed=1;"
+		}
+		if s.Opacity > 0 && s.Opacity < 1 {
+			style += fmt.Sprintf("opacity=%d;", int(s.Opacity*100))
+		}
+		writeDrawIOVertex(&sb, id, "1", s.Label, style, s.Pos.X, s.Pos.Y, s.Width, s.Height)
+
+		if s.Type != d2target.ShapeSQLTable {
+			continue
+		}
+		rh := drawioRowHeight(s)
+		for j, c := range s.Columns {
+			value := c.Name.Label
+			if c.Type.Label != "" {
+				value += " " + c.Type.Label
+			}
+			if cons := c.ConstraintAbbr(); cons != "" {
+				value += "  " + cons
+			}
+			writeDrawIOVertex(&sb, fmt.Sprintf("%sc%d", id, j), id, value, drawioRowStyle, 0, rh*(j+1), s.Width, rh)
+		}
+	}
+
+	for i, c := range d.Connections {
+		style := drawioEdgeStyle
+		if c.StrokeDash > 0 {
+			style += "dashed=1;"
+		}
+		if c.StrokeWidth > 2 {
+			style += fmt.Sprintf("strokeWidth=%d;", c.StrokeWidth)
+		}
+		fmt.Fprintf(&sb, `        <mxCell id="e%d" value="%s" style="%s" edge="1" parent="1" source="%s" target="%s">`+"\n",
+			i, drawioValue(c.Label), style, ids[c.Src], ids[c.Dst])
+		sb.WriteString(`          <mxGeometry relative="1" as="geometry">` + "\n")
+		if n := len(c.Route); n >= 2 {
+			fmt.Fprintf(&sb, `            <mxPoint x="%g" y="%g" as="sourcePoint" />`+"\n", c.Route[0].X, c.Route[0].Y)
+			fmt.Fprintf(&sb, `            <mxPoint x="%g" y="%g" as="targetPoint" />`+"\n", c.Route[n-1].X, c.Route[n-1].Y)
+			if n > 2 {
+				sb.WriteString(`            <Array as="points">` + "\n")
+				for _, p := range c.Route[1 : n-1] {
+					fmt.Fprintf(&sb, `              <mxPoint x="%g" y="%g" />`+"\n", p.X, p.Y)
+				}
+				sb.WriteString("            </Array>\n")
+			}
+		}
+		sb.WriteString("          </mxGeometry>\n")
+		sb.WriteString("        </mxCell>\n")
+	}
+
+	sb.WriteString("      </root>\n")
+	sb.WriteString("    </mxGraphModel>\n")
+	sb.WriteString("  </diagram>\n")
+	sb.WriteString("</mxfile>\n")
+	return sb.String()
+}
+
+// drawioRowHeight is the height of a table's header and each of its rows, d2
+// sizes them all the same.
+func drawioRowHeight(s d2target.Shape) int {
+	return s.Height / (len(s.Columns) + 1)
+}
+
+func writeDrawIOVertex(sb *strings.Builder, id, parent, value, style string, x, y, w, h int) {
+	fmt.Fprintf(sb, `        <mxCell id="%s" value="%s" style="%s" vertex="1" parent="%s">`+"\n", id, drawioValue(value), style, parent)
+	fmt.Fprintf(sb, `          <mxGeometry x="%d" y="%d" width="%d" height="%d" as="geometry" />`+"\n", x, y, w, h)
+	sb.WriteString("        </mxCell>\n")
+}
+
+// drawioValue escapes a label for an html=1 cell.
+func drawioValue(s string) string {
+	return html.EscapeString(strings.ReplaceAll(html.EscapeString(s), "\n", "<br>"))
+}
@@ -0,0 +1,107 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// layoutTestSchema renders the schema with every detail and lays it out with
+// dagre.
+func layoutTestSchema(t *testing.T, s *Schema) *d2target.Diagram {
+	t.Helper()
+	g, err := renderD2(s.Tables, s.FKs, s.Views, s.Types, renderOptions{detail: detailFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := defaultOptions()
+	opts.Layout = "dagre"
+	c, err := compileDiagram(context.Background(), g, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.diagram
+}
+
+type drawioTestCell struct {
+	ID     string `xml:"id,attr"`
+	Value  string `xml:"value,attr"`
+	Style  string `xml:"style,attr"`
+	Vertex string `xml:"vertex,attr"`
+	Edge   string `xml:"edge,attr"`
+	Parent string `xml:"parent,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+func TestRenderDrawIO(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+"CREATE VIEW named_users AS SELECT id, email FROM users;\n")
+	d := layoutTestSchema(t, s)
+
+	var doc struct {
+		Cells []drawioTestCell `xml:"diagram>mxGraphModel>root>mxCell"`
+	}
+	if err := xml.Unmarshal([]byte(renderDrawIO(d)), &doc); err != nil {
+		t.Fatalf("not valid XML: %v", err)
+	}
+
+	cells := map[string]drawioTestCell{}
+	byValue := map[string]drawioTestCell{}
+	var edges []drawioTestCell
+	for _, c := range doc.Cells {
+		cells[c.ID] = c
+		if c.Edge == "1" {
+			edges = append(edges, c)
+		} else if c.Vertex == "1" && c.Parent == "1" {
+			byValue[c.Value] = c
+		}
+	}
+
+	members, ok := byValue["project_members"]
+	if !ok {
+		t.Fatalf("no project_members cell in %+v", doc.Cells)
+	}
+	if !strings.HasPrefix(members.Style, "swimlane;") {
+		t.Errorf("project_members style %q, want a swimlane", members.Style)
+	}
+	var rows []string
+	for _, c := range doc.Cells {
+		if c.Parent == members.ID {
+			rows = append(rows, c.Value)
+		}
+	}
+	if len(rows) != 3 || !strings.HasPrefix(rows[0], "project_id") || !strings.HasPrefix(rows[2], "role") {
+		t.Errorf("project_members rows %q, want project_id, user_id and role", rows)
+	}
+
+	view, ok := byValue["named_users"]
+	if !ok {
+		t.Fatalf("no named_users cell in %+v", doc.Cells)
+	}
+	if !strings.Contains(view.Style, "dashed=1;") {
+		t.Errorf("view style %q, want dashed", view.Style)
+	}
+
+	if len(edges) != len(d.Connections) || len(edges) == 0 {
+		t.Fatalf("got %d edges, want the diagram's %d", len(edges), len(d.Connections))
+	}
+	for _, e := range edges {
+		if _, ok := cells[e.Source]; !ok {
+			t.Errorf("edge %s has unknown source %q", e.ID, e.Source)
+		}
+		if _, ok := cells[e.Target]; !ok {
+			t.Errorf("edge %s has unknown target %q", e.ID, e.Target)
+		}
+	}
+}
+
+func TestDrawIOValue(t *testing.T) {
+	if got, want := drawioValue("a<b>\n&"), "a&amp;lt;b&amp;gt;&lt;br&gt;&amp;amp;"; got != want {
+		t.Errorf("drawioValue = %q, want %q", got, want)
+	}
+}
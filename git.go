@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitMigrations lists the .sql files at path as they were at ref, named as
+// they are on disk, and returns a readFunc for their contents at ref. It only
+// reads the local repository's objects, so ref has to have been fetched.
+func gitMigrations(path, ref string) ([]string, readFunc, error) {
+	dir, spec := path, "."
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir, spec = filepath.Dir(path), filepath.Base(path)
+	}
+
+	// ls-tree names paths relative to the directory it runs in
+	out, err := git(dir, "ls-tree", "-r", "-z", "--name-only", ref, "--", spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list migrations at %s: %w", ref, err)
+	}
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if strings.HasSuffix(strings.ToLower(name), ".sql") {
+			files = append(files, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+	}
+
+	read := func(p string) ([]byte, error) {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil, err
+		}
+		return git(dir, "cat-file", "blob", ref+":./"+filepath.ToSlash(rel))
+	}
+	return files, read, nil
+}
+
+// git runs a git command in dir and returns its output.
+func git(dir string, args ...string) ([]byte, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository with db/1.sql committed and tagged v1, then
+// changes 1.sql and adds 2.sql without committing them.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(dir, "db", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	write("1.sql", "CREATE TABLE users (id int);")
+	write("notes.txt", "not a migration")
+	run("add", ".")
+	run("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init")
+	run("tag", "v1")
+	write("1.sql", "CREATE TABLE users (id int, email text);")
+	write("2.sql", "CREATE TABLE posts (id int);")
+	return dir
+}
+
+func TestGitMigrations(t *testing.T) {
+	dir := gitRepo(t)
+	for _, path := range []string{filepath.Join(dir, "db"), filepath.Join(dir, "db", "1.sql")} {
+		files, read, err := gitMigrations(path, "v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{filepath.Join(dir, "db", "1.sql")}
+		if !reflect.DeepEqual(files, want) {
+			t.Fatalf("%s: got files %q, want %q", path, files, want)
+		}
+		b, err := read(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); got != "CREATE TABLE users (id int);" {
+			t.Errorf("%s: read %q, want the committed 1.sql", path, got)
+		}
+	}
+
+	files, read, err := gitMigrations(filepath.Join(dir, "db"), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := parseMigrations(files, enginePostgreSQL, "", read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.Tables["users"].Cols); got != 1 {
+		t.Errorf("users has %d columns at HEAD, want the committed 1", got)
+	}
+}
+
+func TestGitMigrationsErrors(t *testing.T) {
+	dir := gitRepo(t)
+	_, _, err := gitMigrations(filepath.Join(dir, "db"), "no-such-ref")
+	if err == nil || !strings.Contains(err.Error(), "failed to list migrations at no-such-ref") {
+		t.Errorf("got error %v, want one naming the ref", err)
+	}
+	_, _, err = gitMigrations(t.TempDir(), "HEAD")
+	if err == nil {
+		t.Error("expected an error outside a repository")
+	}
+}
@@ -4,7 +4,7 @@ go 1.25.3
 
 require (
 	github.com/pganalyze/pg_query_go/v6 v6.1.0
-	google.golang.org/protobuf v1.36.10 // indirect
+	google.golang.org/protobuf v1.36.10
 )
 
 require (
@@ -19,6 +19,7 @@ require (
 
 require (
 	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
 	oss.terrastruct.com/d2 v0.7.1
 )
 
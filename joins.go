@@ -0,0 +1,46 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// renderQueryDiagrams draws a diagram per query with only the tables it
+// touches. The columns it joins on are marked, the FK edges the joins follow
+// are emphasised and joins that don't follow an FK get a dashed edge.
+func renderQueryDiagrams(ctx context.Context, s *Schema, usage []*queryUsage, opts Options) ([]file, error) {
+	dir := opts.Outputs.QueryDiagrams
+	if dir == "" {
+		return nil, nil
+	}
+
+	var fs []file
+	for _, u := range usage {
+		ks := u.tables()
+		if u.Name == "" || len(ks) == 0 {
+			continue
+		}
+		tables := make(map[string]*Table, len(ks))
+		for _, k := range ks {
+			tables[k] = s.Tables[k]
+		}
+
+		g, err := renderD2(tables, s.FKs, nil, nil, renderOptions{detail: detailFull, joins: u.Joins})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render d2 for query %s: %s", u.Name, err)
+		}
+		c, err := compileDiagram(ctx, g, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render query %s: %w", u.Name, err)
+		}
+
+		fs = append(fs, file{path: path.Join(dir, u.Name+".svg"), content: string(c.svg)})
+		if opts.Outputs.D2 != "" {
+			fs = append(fs, file{path: path.Join(dir, u.Name+".d2"), content: c.d2})
+		}
+	}
+	return fs, nil
+}
@@ -0,0 +1,56 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRenderQueryDiagrams(t *testing.T) {
+	s := blogSchema(enginePostgreSQL)
+	posts := s.Tables["posts"]
+	for i := range posts.Cols {
+		if posts.Cols[i].Name == "user_id" {
+			posts.Cols[i].ForeignKey = &FK{SrcCols: []string{"user_id"}, DstTable: "users", DstCols: []string{"id"}}
+		}
+	}
+	res, err := pgParse("select u.username, c.body from users u join posts p on p.user_id = u.id join comments c on c.author = u.username")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := pgQueryUsage(s, "ListComments", res)
+
+	opts := defaultOptions()
+	opts.Layout = "dagre"
+	opts.Outputs.QueryDiagrams = "queries"
+	files, err := renderQueryDiagrams(context.Background(), s, []*queryUsage{u, newQueryUsage("Nothing")}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].path != "queries/ListComments.svg" || files[1].path != "queries/ListComments.d2" {
+		t.Fatalf("got files %v, want the svg and d2 of ListComments only", filePaths(files))
+	}
+	if !strings.HasPrefix(files[0].content, "<?xml") {
+		t.Errorf("not an SVG: %.40s", files[0].content)
+	}
+
+	d2 := files[1].content
+	for _, want := range []string{
+		"  user_id: text {\n    constraint: FK join\n  }",
+		"  username: text {\n    constraint: join\n  }",
+		// the join following the FK is emphasised
+		"posts.user_id -> users.id: {\n  style.stroke-width: 3\n}",
+		// the one that doesn't gets a dashed edge
+		"comments.author -- users.username: join {",
+		"style.stroke-dash: 3",
+	} {
+		if !strings.Contains(d2, want) {
+			t.Errorf("d2 is missing %q:\n%s", want, d2)
+		}
+	}
+	if strings.Contains(d2, "mood: text {") {
+		t.Errorf("mood isn't joined on:\n%s", d2)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// layoutJSON is the laid out diagram with the model object behind each node,
+// for frontends that draw the ERD themselves.
+type layoutJSON struct {
+	Bounds layoutRect   `json:"bounds"`
+	Nodes  []layoutNode `json:"nodes"`
+	Edges  []layoutEdge `json:"edges"`
+}
+
+type layoutRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type layoutNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"` // table, view, enum, domain, composite or group
+	Label string `json:"label"`
+	layoutRect
+	Rows []layoutRow `json:"rows,omitempty"`
+
+	// the model object the node was drawn from, at most one is set
+	Table *jsonTable `json:"table,omitempty"`
+	View  *jsonView  `json:"view,omitempty"`
+	Type  *jsonType  `json:"type,omitempty"`
+}
+
+// layoutRow is a column row of a table-shaped node, Y is absolute.
+type layoutRow struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type,omitempty"`
+	Constraints []string `json:"constraints,omitempty"`
+	Y           int      `json:"y"`
+	Height      int      `json:"height"`
+}
+
+type layoutEdge struct {
+	ID     string        `json:"id"`
+	Src    string        `json:"src"`
+	Dst    string        `json:"dst"`
+	Label  string        `json:"label,omitempty"`
+	Dashed bool          `json:"dashed,omitempty"`
+	Route  []layoutPoint `json:"route"`
+}
+
+type layoutPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// renderLayoutJSON describes every node of the laid out diagram with its
+// position, rows and model object, and every edge with its route.
+func renderLayoutJSON(s *Schema, d *d2target.Diagram) (string, error) {
+	tl, br := d.BoundingBox()
+	out := layoutJSON{
+		Bounds: layoutRect{X: tl.X, Y: tl.Y, Width: br.X - tl.X, Height: br.Y - tl.Y},
+		Nodes:  []layoutNode{},
+		Edges:  []layoutEdge{},
+	}
+
+	tables := map[string]*Table{}
+	for _, t := range s.Tables {
+		tables[tableLabel(t.Schema, t.Name)] = t
+	}
+	views := map[string]*View{}
+	for _, v := range s.Views {
+		views[tableLabel(v.Schema, v.Name)] = v
+	}
+	types := map[string]*CustomType{}
+	for _, ct := range s.Types {
+		types[ct.TypeKind+"s."+tableLabel(ct.Schema, ct.Name)] = ct
+	}
+
+	for _, sh := range d.Shapes {
+		n := layoutNode{
+			ID:         sh.ID,
+			Kind:       "group",
+			Label:      sh.Label,
+			layoutRect: layoutRect{X: sh.Pos.X, Y: sh.Pos.Y, Width: sh.Width, Height: sh.Height},
+		}
+		var kind string
+		if len(sh.Classes) > 0 {
+			kind = sh.Classes[0]
+		}
+		switch kind {
+		case "table":
+			n.Kind = kind
+			if t := tables[sh.ID]; t != nil {
+				n.Table = toJSONTable(t)
+			}
+		case "view":
+			n.Kind = kind
+			if v := views[strings.TrimPrefix(sh.ID, "views.")]; v != nil {
+				n.View = toJSONView(v)
+			}
+		case "enum", "domain", "composite":
+			n.Kind = kind
+			if ct := types[sh.ID]; ct != nil {
+				n.Type = toJSONType(ct)
+			}
+		}
+		if sh.Type == d2target.ShapeSQLTable {
+			rh := sh.Height / (len(sh.Columns) + 1)
+			for i, c := range sh.Columns {
+				n.Rows = append(n.Rows, layoutRow{
+					Name:        c.Name.Label,
+					Type:        c.Type.Label,
+					Constraints: strings.Fields(strings.Join(c.Constraint, " ")),
+					Y:           sh.Pos.Y + rh*(i+1),
+					Height:      rh,
+				})
+			}
+		}
+		out.Nodes = append(out.Nodes, n)
+	}
+
+	for _, c := range d.Connections {
+		e := layoutEdge{ID: c.ID, Src: c.Src, Dst: c.Dst, Label: c.Label, Dashed: c.StrokeDash > 0, Route: []layoutPoint{}}
+		for _, p := range c.Route {
+			e.Route = append(e.Route, layoutPoint{X: p.X, Y: p.Y})
+		}
+		out.Edges = append(out.Edges, e)
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode layout: %w", err)
+	}
+	return string(b) + "\n", nil
+}
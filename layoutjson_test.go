@@ -0,0 +1,79 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRenderLayoutJSON(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+
+		"CREATE TYPE mood AS ENUM ('sad', 'happy');\n"+
+		"CREATE VIEW named_users AS SELECT id, email FROM users;\n"+
+		"CREATE VIEW audit.recent_users AS SELECT id FROM users;\n")
+	d := layoutTestSchema(t, s)
+
+	js, err := renderLayoutJSON(s, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got layoutJSON
+	if err := json.Unmarshal([]byte(js), &got); err != nil {
+		t.Fatalf("not valid JSON: %v\n%s", err, js)
+	}
+	if got.Bounds.Width <= 0 || got.Bounds.Height <= 0 {
+		t.Errorf("empty bounds %+v", got.Bounds)
+	}
+
+	nodes := map[string]layoutNode{}
+	for _, n := range got.Nodes {
+		nodes[n.ID] = n
+	}
+	members := nodes["project_members"]
+	if members.Kind != "table" || members.Table == nil || members.Table.Name != "project_members" {
+		t.Fatalf("project_members node %+v", members)
+	}
+	if want := [][]string{{"project_id", "user_id"}}; !reflect.DeepEqual(members.Table.Uniques, want) {
+		t.Errorf("project_members uniques %q, want %q", members.Table.Uniques, want)
+	}
+	var rows []string
+	for i, r := range members.Rows {
+		rows = append(rows, r.Name)
+		if r.Y != members.Y+r.Height*(i+1) {
+			t.Errorf("row %s at y %d, want it below the header and previous rows of %+v", r.Name, r.Y, members.layoutRect)
+		}
+	}
+	if want := []string{"project_id", "user_id", "role"}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+
+	if v := nodes["views.named_users"]; v.Kind != "view" || v.View == nil || v.View.Name != "named_users" {
+		t.Errorf("named_users node %+v", v)
+	}
+	if v := nodes["views.audit.recent_users"]; v.Kind != "view" || v.View == nil || v.View.Schema != "audit" {
+		t.Errorf("audit.recent_users node %+v", v)
+	}
+	if e := nodes["enums.mood"]; e.Kind != "enum" || e.Type == nil || !reflect.DeepEqual(e.Type.Values, []string{"sad", "happy"}) {
+		t.Errorf("mood node %+v", e)
+	}
+	if g := nodes["views"]; g.Kind != "group" || g.Table != nil || g.View != nil || g.Type != nil {
+		t.Errorf("views group node %+v", g)
+	}
+
+	if len(got.Edges) != len(d.Connections) || len(got.Edges) == 0 {
+		t.Fatalf("got %d edges, want the diagram's %d", len(got.Edges), len(d.Connections))
+	}
+	for _, e := range got.Edges {
+		if _, ok := nodes[e.Src]; !ok {
+			t.Errorf("edge %s has unknown src %q", e.ID, e.Src)
+		}
+		if _, ok := nodes[e.Dst]; !ok {
+			t.Errorf("edge %s has unknown dst %q", e.ID, e.Dst)
+		}
+		if len(e.Route) < 2 {
+			t.Errorf("edge %s has route %v", e.ID, e.Route)
+		}
+	}
+}
@@ -8,53 +8,88 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/sqlc-dev/plugin-sdk-go/codegen"
 	pb "github.com/sqlc-dev/plugin-sdk-go/plugin"
 
-	"oss.terrastruct.com/d2/d2format"
-	"oss.terrastruct.com/d2/d2graph"
-	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
-	"oss.terrastruct.com/d2/d2layouts/d2elklayout"
-	"oss.terrastruct.com/d2/d2lib"
-	"oss.terrastruct.com/d2/d2renderers/d2svg"
-	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
 	d2log "oss.terrastruct.com/d2/lib/log"
-	"oss.terrastruct.com/d2/lib/textmeasure"
 )
 
+// Schema is the model every output is rendered from, whether it was parsed
+// from migration files or converted from sqlc's catalog.
+type Schema struct {
+	Engine string   // sqlc engine the schema was written for
+	Files  []string // migration files it was parsed from, in order, if any
+	Tables map[string]*Table
+	FKs    []FK // table-level foreign keys
+	Views  map[string]*View
+	Types  map[string]*CustomType
+}
+
 type Column struct {
 	Name       string
 	Type       string
 	PrimaryKey bool
 	Unique     bool
+	NotNull    bool
 	ForeignKey *FK // optional
+	Created    *Location
+	Altered    []*Location
 }
 type Table struct {
 	Schema      string
 	Name        string
 	Cols        []Column
 	Constraints []TableConstraint
+	Uniques     [][]string     // multi-column unique constraints, single columns are marked Unique
+	Keys        map[string]Key // named primary and unique keys, for dropping them by name
+	Created     *Location      // nil when not parsed from a migration
+	Altered     []*Location    // every later statement that changed it, in order
+}
+
+// Key is the columns a primary key or unique constraint covers.
+type Key struct {
+	Primary bool
+	Cols    []string
+}
+
+// Location is the migration file and line a statement starts at.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l *Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
 }
 
 type TableConstraint struct {
 	Name        string
 	Type        string // "CHECK", "UNIQUE", "PRIMARY", etc.
 	Description string
+	Created     *Location
 }
 type FK struct {
+	Name string // constraint name, if known
+	// SrcSchema and SrcTable are the table a table-level FK is declared on.
+	SrcSchema, SrcTable string
 	SrcCols             []string
 	DstSchema, DstTable string
 	DstCols             []string
+	Created             *Location
 }
 type View struct {
-	Schema string
-	Name   string
-	Query  string
-	Cols   []Column
+	Schema  string
+	Name    string
+	Query   string
+	Cols    []Column
+	Created *Location
+	Altered []*Location
 }
 type CustomType struct {
 	Schema    string
@@ -67,14 +102,47 @@ type CustomType struct {
 	Collation string   // for domains
 	Default   string   // for domains
 	NotNull   bool     // for domains
+	Created   *Location
+	Altered   []*Location
 }
 
 var migrationDir = pflag.StringP("migrations", "m", "", "path to migration files or directory")
+var engine = pflag.StringP("engine", "e", enginePostgreSQL, "SQL dialect of the migrations: postgresql, mysql or sqlite")
+var queryPaths = pflag.StringSliceP("queries", "q", nil, "paths to sqlc query files or directories, for query usage")
+var optionsJSON = pflag.String("options", "", "plugin options as JSON, same as the sqlc.yaml codegen options block")
+var modelPath = pflag.String("model", "", "path to a JSON or YAML model snapshot to render instead of migrations")
+var until = pflag.String("until", "", "stop applying migrations after this file or version")
+var base = pflag.String("base", "", "git ref to read the migrations at, for diff to compare the working tree against")
+var watch = pflag.Bool("watch", false, "write the files again whenever the migrations, queries or model change")
+var serve = pflag.String("serve", "", "address to serve a live preview of the SVG on, like :8080 (implies --watch)")
+var formats = pflag.StringSliceP("format", "f", nil, "diagram formats to write: svg, d2, mermaid, dbml, plantuml, dot, drawio, layout, json, yaml, dictionary, html, timeline (default from the options)")
 
 func main() {
 	pflag.Parse()
-	if *migrationDir != "" {
-		err := runLocal(*migrationDir)
+	if pflag.Arg(0) == "check" {
+		err := fmt.Errorf("check needs -m or --model, like the command that wrote the files")
+		if *migrationDir != "" || *modelPath != "" {
+			err = runCheck(*migrationDir, []byte(*optionsJSON))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if pflag.Arg(0) == "diff" {
+		if err := runDiff(pflag.Args()[1:], []byte(*optionsJSON)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if *migrationDir != "" || *modelPath != "" {
+		local := runLocal
+		if *watch || *serve != "" {
+			local = runWatch
+		}
+		err := local(*migrationDir, []byte(*optionsJSON))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed: %s\n", err.Error())
 			os.Exit(1)
@@ -85,26 +153,259 @@ func main() {
 	runPlugin()
 }
 
-func runLocal(dir string) error {
+func runLocal(dir string, rawOpts []byte) error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
-	files := walkMigrations([]string{dir})
-	if len(files) == 0 {
-		return fmt.Errorf("unable to find any schemas")
+	ctx = d2log.With(ctx, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+
+	opts, err := localOptions(rawOpts)
+	if err != nil {
+		return err
 	}
+	f, err := localFiles(ctx, dir, opts)
+	if err != nil {
+		return err
+	}
+	return writeFiles(f)
+}
 
-	ctx = d2log.With(ctx, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+// runCheck regenerates what runLocal would write and fails, listing them, if
+// any of the files on disk differ, so CI can keep committed diagrams fresh.
+func runCheck(dir string, rawOpts []byte) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	// the list goes to stdout, so keep d2's logs out of it
+	ctx = d2log.With(ctx, slog.New(slog.NewTextHandler(os.Stderr, nil)))
 
-	f, err := run(ctx, files)
+	opts, err := localOptions(rawOpts)
+	if err != nil {
+		return err
+	}
+	f, err := localFiles(ctx, dir, opts)
 	if err != nil {
 		return err
 	}
+	stale, err := outdated(f)
+	if err != nil {
+		return err
+	}
+	for _, s := range stale {
+		fmt.Println(s)
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("%s out of date, regenerate them", plural(len(stale), "file"))
+	}
+	return nil
+}
 
-	return writeFiles(f)
+// localOptions are the plugin options given as JSON, with the flags that
+// override them applied.
+func localOptions(rawOpts []byte) (Options, error) {
+	opts, err := parseOptions(rawOpts)
+	if err != nil {
+		return Options{}, err
+	}
+	if len(*formats) > 0 {
+		if err := opts.Outputs.selectFormats(*formats); err != nil {
+			return Options{}, err
+		}
+	}
+	if *until != "" {
+		opts.Until = *until
+	}
+	if err := opts.validate(); err != nil {
+		return Options{}, err
+	}
+	if *base != "" {
+		return Options{}, fmt.Errorf("--base only works with the diff command")
+	}
+	if *modelPath != "" && opts.Until != "" {
+		return Options{}, fmt.Errorf("--until needs migration files, not a model")
+	}
+	return opts, nil
+}
+
+// localFiles renders the files the options ask for, from migrations in dir
+// or a model snapshot.
+func localFiles(ctx context.Context, dir string, opts Options) ([]file, error) {
+	var s *Schema
+	var err error
+	if *modelPath != "" {
+		s, err = readModel(*modelPath)
+	} else {
+		files := walkMigrations([]string{dir})
+		if len(files) == 0 {
+			return nil, fmt.Errorf("unable to find any schemas")
+		}
+		s, err = parseMigrations(files, *engine, opts.Until, os.ReadFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []*pb.Query
+	if len(*queryPaths) > 0 {
+		queries, err = loadQueries(walkMigrations(*queryPaths))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return run(ctx, s, queries, opts)
+}
+
+// diffFiles are the files the diff command writes, by format.
+var diffFiles = map[string]string{
+	"svg":       "diff.svg",
+	"d2":        "diff.d2",
+	"summary":   "diff.md",
+	"changelog": "schema-changes.md",
+}
+
+// runDiff compares two schemas, given either as two migration directories,
+// files or model snapshots, as -m's migrations at the git ref --base and in
+// the working tree, or as two versions of them with --until OLD or OLD..NEW.
+// It writes the diff diagram and summary and prints
+// the summary.
+func runDiff(args []string, rawOpts []byte) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	opts, err := parseOptions(rawOpts)
+	if err != nil {
+		return err
+	}
+	if *modelPath != "" {
+		return fmt.Errorf("give diff the model snapshots as arguments, not --model")
+	}
+	want := map[string]bool{"svg": true, "summary": true}
+	if len(*formats) > 0 {
+		want = map[string]bool{}
+		for _, f := range *formats {
+			f = strings.ToLower(strings.TrimSpace(f))
+			if _, ok := diffFiles[f]; !ok {
+				return fmt.Errorf("unknown diff format %q, must be one of %s", f, strings.Join(sortedKeys(diffFiles), ", "))
+			}
+			want[f] = true
+		}
+	}
+	// the summary goes to stdout, so keep d2's logs out of it
+	ctx = d2log.With(ctx, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	var old, cur *Schema
+	switch {
+	case *migrationDir != "" && len(args) > 0:
+		return fmt.Errorf("diff takes either -m or two schemas, not both")
+	case *migrationDir != "" && *base != "":
+		if *until != "" {
+			return fmt.Errorf("diff takes either --base or --until, not both")
+		}
+		baseFiles, read, err := gitMigrations(*migrationDir, *base)
+		if err != nil {
+			return err
+		}
+		if len(baseFiles) == 0 {
+			return fmt.Errorf("unable to find any schemas in %s at %s", *migrationDir, *base)
+		}
+		if old, err = parseMigrations(baseFiles, *engine, "", read); err != nil {
+			return err
+		}
+		files := walkMigrations([]string{*migrationDir})
+		if len(files) == 0 {
+			return fmt.Errorf("unable to find any schemas")
+		}
+		if cur, err = parseMigrations(files, *engine, "", os.ReadFile); err != nil {
+			return err
+		}
+	case *migrationDir != "":
+		if *until == "" {
+			return fmt.Errorf("diff -m needs --base REF, or --until OLD or OLD..NEW")
+		}
+		files := walkMigrations([]string{*migrationDir})
+		if len(files) == 0 {
+			return fmt.Errorf("unable to find any schemas")
+		}
+		from, to, err := untilRange(*until)
+		if err != nil {
+			return err
+		}
+		if old, err = parseMigrations(slices.Clone(files), *engine, from, os.ReadFile); err != nil {
+			return err
+		}
+		if cur, err = parseMigrations(files, *engine, to, os.ReadFile); err != nil {
+			return err
+		}
+	case len(args) == 2:
+		if *until != "" || *base != "" {
+			return fmt.Errorf("--until and --base need -m when diffing")
+		}
+		if old, err = diffInput(args[0]); err != nil {
+			return err
+		}
+		if cur, err = diffInput(args[1]); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("diff needs two schemas to compare, or -m with --base or --until")
+	}
+	opts.applyFilters(old)
+	opts.applyFilters(cur)
+
+	d := diffSchemas(old, cur)
+	summary := renderDiffSummary(d)
+	fmt.Print(summary)
+
+	opts.Outputs = Outputs{}
+	if want["svg"] {
+		opts.Outputs.SVG = diffFiles["svg"]
+	}
+	if want["d2"] {
+		opts.Outputs.D2 = diffFiles["d2"]
+	}
+	fs, err := renderDiffDiagram(ctx, mergeSchemas(old, cur, d), d, opts)
+	if err != nil {
+		return err
+	}
+	if want["summary"] {
+		fs = append(fs, file{path: diffFiles["summary"], content: summary})
+	}
+	if want["changelog"] {
+		fs = append(fs, file{path: diffFiles["changelog"], content: renderChangelog(d)})
+	}
+	return writeFiles(fs)
+}
+
+// untilRange splits diff's --until OLD or OLD..NEW. NEW is "" for the latest
+// migration; an empty bound on either side of ".." is an error, since an
+// empty until would select every migration.
+func untilRange(until string) (from, to string, err error) {
+	from, to, isRange := strings.Cut(until, "..")
+	if strings.TrimSpace(from) == "" || isRange && strings.TrimSpace(to) == "" {
+		return "", "", fmt.Errorf("invalid --until %q, want OLD or OLD..NEW", until)
+	}
+	return from, to, nil
+}
+
+// diffInput reads one side of a diff: a model snapshot, or a directory or
+// file of migrations.
+func diffInput(path string) (*Schema, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return readModel(path)
+	}
+	files := walkMigrations([]string{path})
+	if len(files) == 0 {
+		return nil, fmt.Errorf("unable to find any schemas in %s", path)
+	}
+	return parseMigrations(files, *engine, "", os.ReadFile)
 }
 
 func writeFiles(files []file) error {
 	for _, f := range files {
+		if dir := filepath.Dir(f.path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", dir, err)
+			}
+		}
 		err := os.WriteFile(f.path, []byte(f.content), 0644)
 		if err != nil {
 			return fmt.Errorf("failed to write file %s: %w", f.path, err)
@@ -118,75 +419,95 @@ type file struct {
 	content string
 }
 
-func run(ctx context.Context, files []string) ([]file, error) {
+// parseMigrations parses the migration files in the order sqlc applies them,
+// up to and including until if it's set.
+func parseMigrations(files []string, engine, until string, read readFunc) (*Schema, error) {
 	// Keep sqlc’s lexicographic ordering behavior
 	sort.Strings(files)
+	if until != "" {
+		var err error
+		files, err = migrationsUntil(files, until)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	tables, tableLevelFKs, views, customTypes, err := parseFiles(files)
+	s, err := parseFiles(files, engine, read)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse files: %s", err)
 	}
+	s.Files = files
+	return s, nil
+}
 
-	g, err := renderD2(tables, *tableLevelFKs, views, customTypes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to render d2: %s", err)
+func run(ctx context.Context, s *Schema, queries []*pb.Query, opts Options) ([]file, error) {
+	opts.applyFilters(s)
+
+	var usage []*queryUsage
+	if opts.QueryUsage || opts.Outputs.UnusedMarkdown != "" || opts.Outputs.UnusedJSON != "" || opts.Outputs.QueryDiagrams != "" {
+		usage = analyzeQueries(s, queries)
 	}
 
-	ruler, err := textmeasure.NewRuler()
+	fs, err := renderDiagram(ctx, s, usage, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create text ruler: %w", err)
+		return nil, err
 	}
-	if ruler == nil {
-		return nil, fmt.Errorf("text ruler was nil")
-	}
-
-	gf := d2format.Format(g.AST)
 
-	lr := func(engine string) (d2graph.LayoutGraph, error) {
-		switch engine {
-		case "elk":
-			return d2elklayout.DefaultLayout, nil
-		case "dagre":
-			return d2dagrelayout.DefaultLayout, nil
-		default:
-			return nil, fmt.Errorf("unknown layout engine: %s", engine)
-		}
+	qfs, err := renderQueryDiagrams(ctx, s, usage, opts)
+	if err != nil {
+		return nil, err
 	}
+	fs = append(fs, qfs...)
 
-	// themeID := int64(d2themescatalog.DarkFlagshipTerrastruct.ID)
-	themeID := int64(d2themescatalog.NeutralGrey.ID)
-	// Compile D2 -> diagram
-
-	diagram, _, err := d2lib.Compile(ctx, gf,
-		&d2lib.CompileOptions{
-			LayoutResolver: lr,
-			Layout:         strPtr("elk"),
-			Ruler:          ruler,
-		},
-		&d2svg.RenderOpts{ThemeID: &themeID},
-	)
-
+	tfs, err := renderTimeline(ctx, s, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile d2: %w", err)
+		return nil, err
 	}
+	fs = append(fs, tfs...)
 
-	// Render diagram -> SVG bytes
-	svg, err := d2svg.Render(diagram, &d2svg.RenderOpts{
-		ThemeID: &themeID,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to render svg: %w", err)
+	if opts.Outputs.Mermaid != "" {
+		fs = append(fs, file{path: opts.Outputs.Mermaid, content: renderMermaid(s)})
+	}
+	if opts.Outputs.DBML != "" {
+		fs = append(fs, file{path: opts.Outputs.DBML, content: renderDBML(s)})
+	}
+	if opts.Outputs.PlantUML != "" {
+		fs = append(fs, file{path: opts.Outputs.PlantUML, content: renderPlantUML(s)})
+	}
+	if opts.Outputs.DOT != "" {
+		fs = append(fs, file{path: opts.Outputs.DOT, content: renderDOT(s)})
+	}
+
+	if opts.Outputs.Dictionary != "" {
+		fs = append(fs, file{path: opts.Outputs.Dictionary, content: renderDictionary(s)})
+	}
+	if opts.Outputs.ModelJSON != "" {
+		content, err := encodeModelJSON(s)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, file{path: opts.Outputs.ModelJSON, content: content})
+	}
+	if opts.Outputs.ModelYAML != "" {
+		content, err := encodeModelYAML(s)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, file{path: opts.Outputs.ModelYAML, content: content})
 	}
 
-	fs := []file{
-		{
-			path:    "schema.svg",
-			content: string(svg),
-		},
-		{
-			path:    "schema.d2",
-			content: gf,
-		},
+	if opts.Outputs.UnusedMarkdown != "" || opts.Outputs.UnusedJSON != "" {
+		unused := findUnused(s, usage)
+		if opts.Outputs.UnusedMarkdown != "" {
+			fs = append(fs, file{path: opts.Outputs.UnusedMarkdown, content: unused.markdown()})
+		}
+		if opts.Outputs.UnusedJSON != "" {
+			content, err := unused.json()
+			if err != nil {
+				return nil, err
+			}
+			fs = append(fs, file{path: opts.Outputs.UnusedJSON, content: content})
+		}
 	}
 
 	return fs, nil
@@ -198,12 +519,17 @@ func runPlugin() {
 		// interferes with the plugin protocol.
 		ctx = d2log.With(ctx, slog.New(slog.DiscardHandler))
 
-		files := walkMigrations(gr.Settings.Schema)
-		if len(files) == 0 {
-			return &pb.GenerateResponse{}, fmt.Errorf("unable to find any schemas")
+		opts, err := parseOptions(gr.PluginOptions)
+		if err != nil {
+			return &pb.GenerateResponse{}, err
+		}
+
+		s, err := pluginSchema(gr, opts)
+		if err != nil {
+			return &pb.GenerateResponse{}, err
 		}
 
-		f, err := run(ctx, files)
+		f, err := run(ctx, s, gr.GetQueries(), opts)
 		if err != nil {
 			return &pb.GenerateResponse{}, err
 		}
@@ -222,6 +548,73 @@ func runPlugin() {
 	})
 }
 
+// pluginSchema builds the model from the schema files listed in sqlc.yaml,
+// the catalog sqlc already parsed or a model snapshot, depending on
+// opts.Input.
+func pluginSchema(gr *pb.GenerateRequest, opts Options) (*Schema, error) {
+	engine := gr.GetSettings().GetEngine()
+	if opts.Input == inputModel {
+		return readModel(opts.Model)
+	}
+	if opts.Input == inputCatalog {
+		return schemaFromCatalog(gr.GetCatalog(), engine), nil
+	}
+
+	files := walkMigrations(gr.GetSettings().GetSchema())
+	if len(files) > 0 {
+		return parseMigrations(files, engine, opts.Until, os.ReadFile)
+	}
+	if opts.Input == inputAuto && gr.GetCatalog() != nil && opts.Until == "" {
+		return schemaFromCatalog(gr.GetCatalog(), engine), nil
+	}
+	return nil, fmt.Errorf("unable to find any schemas")
+}
+
+// migrationsUntil cuts the files, in the order parseMigrations applies them,
+// after the one until names, either by path or base name, or after the last
+// one whose version is at most until that comes before any newer one. The
+// version only picks where to cut: the files keep sqlc's lexicographic order,
+// so 10_b.sql still comes before 9_a.sql.
+func migrationsUntil(files []string, until string) ([]string, error) {
+	for i, f := range files {
+		if f == until || filepath.Base(f) == until || filepath.Clean(f) == filepath.Clean(until) {
+			return files[:i+1], nil
+		}
+	}
+
+	want, ok := migrationVersion(until)
+	if !ok {
+		return nil, fmt.Errorf("no migration file or version matches until %q", until)
+	}
+	n := 0
+	for i, f := range files {
+		v, ok := migrationVersion(filepath.Base(f))
+		if !ok {
+			continue
+		}
+		if v > want {
+			break
+		}
+		n = i + 1
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no migration comes before the first one after version %s", until)
+	}
+	return files[:n], nil
+}
+
+// migrationVersion is the number a migration file name starts with, like
+// 0007 in tern's 0007_add_users.sql or 2 in Flyway's V2__init.sql.
+func migrationVersion(name string) (uint64, bool) {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "V"), "v")
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(name)
+	}
+	v, err := strconv.ParseUint(name[:end], 10, 64)
+	return v, err == nil
+}
+
 func walkMigrations(migPaths []string) []string {
 	var files []string
 	for _, p := range migPaths {
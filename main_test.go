@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdataSchema parses the PostgreSQL migrations in testdata.
+func testdataSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := parseMigrations(walkMigrations([]string{"testdata/migrations"}), "postgresql", "", os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func filePaths(files []file) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.path)
+	}
+	return out
+}
+
+// parseTestSQL parses the statements as one PostgreSQL migration file.
+func parseTestSQL(t *testing.T, sql string) *Schema {
+	t.Helper()
+	s, err := parseFiles([]string{"1.sql"}, enginePostgreSQL, func(string) ([]byte, error) {
+		return []byte(sql), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// membersSQL has a one-to-one, a composite unique and a table-level FK whose
+// columns another table also has.
+const membersSQL = `
+CREATE TABLE projects (id int PRIMARY KEY, name text NOT NULL);
+CREATE TABLE users (id int PRIMARY KEY, email text UNIQUE);
+CREATE TABLE profiles (user_id int UNIQUE REFERENCES users(id), bio text);
+CREATE TABLE audit (project_id int, user_id int);
+CREATE TABLE project_members (
+	project_id int REFERENCES projects(id),
+	user_id int,
+	role text,
+	UNIQUE (project_id, user_id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+`
+
+func TestMigrationsUntil(t *testing.T) {
+	// sorted the way parseMigrations sorts them, which isn't by version
+	files := []string{"db/10_b.sql", "db/11_c.sql", "db/9_a.sql", "db/seed.sql"}
+	tests := []struct {
+		until   string
+		want    []string
+		wantErr string
+	}{
+		{until: "11_c.sql", want: []string{"db/10_b.sql", "db/11_c.sql"}},
+		{until: "db/10_b.sql", want: []string{"db/10_b.sql"}},
+		{until: "./db/../db/9_a.sql", want: []string{"db/10_b.sql", "db/11_c.sql", "db/9_a.sql"}},
+		{until: "seed.sql", want: []string{"db/10_b.sql", "db/11_c.sql", "db/9_a.sql", "db/seed.sql"}},
+		{until: "10", want: []string{"db/10_b.sql"}},
+		{until: "0011", want: []string{"db/10_b.sql", "db/11_c.sql", "db/9_a.sql"}},
+		{until: "9", wantErr: "no migration comes before the first one after version 9"},
+		{until: "nope", wantErr: `no migration file or version matches until "nope"`},
+	}
+	for _, tt := range tests {
+		got, err := migrationsUntil(files, tt.until)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("until %q: got error %v, want %q", tt.until, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("until %q: %v", tt.until, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("until %q: got %q, want %q", tt.until, got, tt.want)
+		}
+	}
+}
+
+func TestMigrationVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		want uint64
+		ok   bool
+	}{
+		{"0007_add_users.sql", 7, true},
+		{"V2__init.sql", 2, true},
+		{"v10.sql", 10, true},
+		{"20240101120000_x.up.sql", 20240101120000, true},
+		{"seed.sql", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := migrationVersion(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("migrationVersion(%q) = %d, %v, want %d, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUntilRange(t *testing.T) {
+	tests := []struct {
+		until, from, to string
+		wantErr         bool
+	}{
+		{until: "5", from: "5"},
+		{until: "5..12", from: "5", to: "12"},
+		{until: "a.sql..b.sql", from: "a.sql", to: "b.sql"},
+		{until: "..12", wantErr: true},
+		{until: "5..", wantErr: true},
+		{until: "..", wantErr: true},
+		{until: " ..12", wantErr: true},
+	}
+	for _, tt := range tests {
+		from, to, err := untilRange(tt.until)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("untilRange(%q) = %q, %q, want an error", tt.until, from, to)
+			}
+			continue
+		}
+		if err != nil || from != tt.from || to != tt.to {
+			t.Errorf("untilRange(%q) = %q, %q, %v, want %q, %q", tt.until, from, to, err, tt.from, tt.to)
+		}
+	}
+}
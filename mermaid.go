@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mermaidUnsafe matches what Mermaid doesn't accept in entity names and
+// attribute types and names.
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_\-\[\]()]+`)
+
+// renderMermaid writes the schema as a Mermaid erDiagram. Views are drawn as
+// entities without relationships, Mermaid has no way to style them apart.
+func renderMermaid(s *Schema) string {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+
+	for _, k := range sortedKeys(s.Tables) {
+		t := s.Tables[k]
+		writeMermaidEntity(&sb, tableLabel(t.Schema, t.Name), t.Cols)
+	}
+	for _, k := range sortedKeys(s.Views) {
+		v := s.Views[k]
+		writeMermaidEntity(&sb, tableLabel(v.Schema, v.Name), v.Cols)
+	}
+
+	for _, r := range s.relations() {
+		// the referenced side is always exactly one, the referencing side
+		// many unless its columns are unique
+		card := "}o"
+		if r.Unique {
+			card = "|o"
+		}
+		fmt.Fprintf(&sb, "    %s %s--|| %s : %q\n",
+			safeID(tableLabel(r.From.Schema, r.From.Name)), card,
+			safeID(tableLabel(r.To.Schema, r.To.Name)),
+			strings.Join(r.FromCols, ", "))
+	}
+	return sb.String()
+}
+
+func writeMermaidEntity(sb *strings.Builder, label string, cols []Column) {
+	id := safeID(label)
+	sb.WriteString("    " + id)
+	if id != label {
+		fmt.Fprintf(sb, "[%q]", label)
+	}
+	if len(cols) == 0 {
+		sb.WriteString("\n")
+		return
+	}
+	sb.WriteString(" {\n")
+	for _, c := range cols {
+		typ := strings.TrimPrefix(c.Type, "pg_catalog.")
+		if typ == "" || typ == "unknown" {
+			typ = "unknown"
+		}
+		var keys []string
+		if c.PrimaryKey {
+			keys = append(keys, "PK")
+		}
+		if c.ForeignKey != nil {
+			keys = append(keys, "FK")
+		}
+		if c.Unique {
+			keys = append(keys, "UK")
+		}
+		fmt.Fprintf(sb, "        %s %s", safeID(typ), safeID(c.Name))
+		if len(keys) > 0 {
+			fmt.Fprintf(sb, " %s", strings.Join(keys, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("    }\n")
+}
+
+// safeID turns a name into something Mermaid and PlantUML accept as an
+// identifier.
+func safeID(s string) string {
+	return strings.Trim(mermaidUnsafe.ReplaceAllString(s, "_"), "_")
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestRenderMermaid(t *testing.T) {
+	want := `erDiagram
+    audit {
+        int4 project_id
+        int4 user_id
+    }
+    profiles {
+        int4 user_id FK, UK
+        text bio
+    }
+    project_members {
+        int4 project_id FK
+        int4 user_id
+        text role
+    }
+    projects {
+        int4 id PK
+        text name
+    }
+    users {
+        int4 id PK
+        text email UK
+    }
+    profiles |o--|| users : "user_id"
+    project_members }o--|| projects : "project_id"
+    project_members }o--|| users : "user_id"
+`
+	if got := renderMermaid(parseTestSQL(t, membersSQL)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+func newSchema(engine string) *Schema {
+	return &Schema{
+		Engine: engine,
+		Tables: map[string]*Table{},
+		Views:  map[string]*View{},
+		Types:  map[string]*CustomType{},
+	}
+}
+
+// Table manipulation utilities
+func key(s, t string) string {
+	if s == "" {
+		return t
+	}
+	return s + "." + t
+}
+
+func ensureTable(m map[string]*Table, s, t string) *Table {
+	k := key(s, t)
+	if m[k] == nil {
+		m[k] = &Table{Schema: s, Name: t}
+	}
+	return m[k]
+}
+
+// alteredAt appends loc to an object's alterations, skipping the statement
+// that created it and repeats from the same statement.
+func alteredAt(locs []*Location, created, loc *Location) []*Location {
+	if loc == nil || loc == created || len(locs) > 0 && locs[len(locs)-1] == loc {
+		return locs
+	}
+	return append(locs, loc)
+}
+
+func upsertCol(cols []Column, c Column) []Column {
+	for i := range cols {
+		if cols[i].Name == c.Name {
+			cols[i].Altered = alteredAt(cols[i].Altered, cols[i].Created, c.Created)
+			if c.Type != "" {
+				cols[i].Type = c.Type
+			}
+			cols[i].PrimaryKey = cols[i].PrimaryKey || c.PrimaryKey
+			cols[i].Unique = cols[i].Unique || c.Unique
+			cols[i].NotNull = cols[i].NotNull || c.NotNull
+			if c.ForeignKey != nil {
+				cols[i].ForeignKey = c.ForeignKey
+			}
+			return cols
+		}
+	}
+	return append(cols, c)
+}
+
+// replaceCol swaps the definition of the column named old for c, the way
+// MySQL's MODIFY and CHANGE do. Keys are indexes in MySQL and outlive the
+// definition, so the PK, unique and FK flags carry over, but everything else,
+// NOT NULL included, comes from c.
+func replaceCol(cols []Column, old string, c Column) []Column {
+	for i := range cols {
+		if cols[i].Name != old {
+			continue
+		}
+		c.PrimaryKey = c.PrimaryKey || cols[i].PrimaryKey
+		c.Unique = c.Unique || cols[i].Unique
+		if c.ForeignKey == nil && cols[i].ForeignKey != nil {
+			fk := *cols[i].ForeignKey
+			fk.SrcCols = []string{c.Name}
+			c.ForeignKey = &fk
+		}
+		c.Created, c.Altered = cols[i].Created, alteredAt(cols[i].Altered, cols[i].Created, c.Created)
+		cols[i] = c
+		return cols
+	}
+	return append(cols, c)
+}
+
+func findCol(t *Table, name string) *Column {
+	for i := range t.Cols {
+		if t.Cols[i].Name == name {
+			return &t.Cols[i]
+		}
+	}
+	return nil
+}
+
+func removeCol(cols []Column, name string) []Column {
+	result := make([]Column, 0, len(cols))
+	for _, col := range cols {
+		if col.Name != name {
+			result = append(result, col)
+		}
+	}
+	return result
+}
+
+func markPK(t *Table, name string, loc *Location) {
+	for i := range t.Cols {
+		if t.Cols[i].Name == name {
+			t.Cols[i].PrimaryKey = true
+			t.Cols[i].Altered = alteredAt(t.Cols[i].Altered, t.Cols[i].Created, loc)
+		}
+	}
+}
+
+// markUnique records a unique constraint on the columns. Only a single column
+// is unique on its own, several are kept together in t.Uniques.
+func markUnique(t *Table, names []string, loc *Location) {
+	switch len(names) {
+	case 0:
+	case 1:
+		for i := range t.Cols {
+			if t.Cols[i].Name == names[0] {
+				t.Cols[i].Unique = true
+				t.Cols[i].Altered = alteredAt(t.Cols[i].Altered, t.Cols[i].Created, loc)
+			}
+		}
+	default:
+		if !slices.ContainsFunc(t.Uniques, func(u []string) bool { return slices.Equal(u, names) }) {
+			t.Uniques = append(t.Uniques, names)
+		}
+	}
+}
+
+// nameKey records the name of a primary key or unique constraint on t.
+func nameKey(t *Table, name string, primary bool, cols []string) {
+	if name == "" || len(cols) == 0 {
+		return
+	}
+	if t.Keys == nil {
+		t.Keys = map[string]Key{}
+	}
+	t.Keys[name] = Key{Primary: primary, Cols: cols}
+}
+
+// dropConstraint removes the check, key or foreign key constraint called name
+// from t.
+func dropConstraint(t *Table, fks *[]FK, name string, loc *Location) {
+	t.Constraints = slices.DeleteFunc(t.Constraints, func(c TableConstraint) bool { return c.Name == name })
+	*fks = slices.DeleteFunc(*fks, func(fk FK) bool {
+		return fk.Name == name && fk.SrcSchema == t.Schema && fk.SrcTable == t.Name
+	})
+	for i := range t.Cols {
+		if fk := t.Cols[i].ForeignKey; fk != nil && fk.Name == name {
+			t.Cols[i].ForeignKey = nil
+			t.Cols[i].Altered = alteredAt(t.Cols[i].Altered, t.Cols[i].Created, loc)
+		}
+	}
+	if k, ok := t.Keys[name]; ok {
+		dropKey(t, k, loc)
+		delete(t.Keys, name)
+	}
+}
+
+// dropPrimaryKey removes t's primary key, whatever it's called.
+func dropPrimaryKey(t *Table, loc *Location) {
+	for i := range t.Cols {
+		if t.Cols[i].PrimaryKey {
+			t.Cols[i].PrimaryKey = false
+			t.Cols[i].Altered = alteredAt(t.Cols[i].Altered, t.Cols[i].Created, loc)
+		}
+	}
+	maps.DeleteFunc(t.Keys, func(_ string, k Key) bool { return k.Primary })
+}
+
+func dropKey(t *Table, k Key, loc *Location) {
+	if !k.Primary && len(k.Cols) > 1 {
+		t.Uniques = slices.DeleteFunc(t.Uniques, func(u []string) bool { return slices.Equal(u, k.Cols) })
+		return
+	}
+	for _, n := range k.Cols {
+		if c := findCol(t, n); c != nil {
+			if k.Primary {
+				c.PrimaryKey = false
+			} else {
+				c.Unique = false
+			}
+			c.Altered = alteredAt(c.Altered, c.Created, loc)
+		}
+	}
+}
+
+// renameConstraint renames t's check, key or foreign key constraint.
+func renameConstraint(t *Table, fks []FK, old, name string) {
+	for i := range t.Constraints {
+		if t.Constraints[i].Name == old {
+			t.Constraints[i].Name = name
+		}
+	}
+	for i := range fks {
+		if fk := &fks[i]; fk.Name == old && fk.SrcSchema == t.Schema && fk.SrcTable == t.Name {
+			fk.Name = name
+		}
+	}
+	for i := range t.Cols {
+		if fk := t.Cols[i].ForeignKey; fk != nil && fk.Name == old {
+			fk.Name = name
+		}
+	}
+	if k, ok := t.Keys[old]; ok {
+		delete(t.Keys, old)
+		t.Keys[name] = k
+	}
+}
+
+// renameColumn renames a column of t along with every key and foreign key
+// that lists it, on t or pointing at it.
+func renameColumn(tables map[string]*Table, fks []FK, t *Table, old, name string, loc *Location) {
+	c := findCol(t, old)
+	if c == nil {
+		return
+	}
+	c.Name = name
+	c.Altered = alteredAt(c.Altered, c.Created, loc)
+
+	rename := func(cols []string) {
+		for i := range cols {
+			if cols[i] == old {
+				cols[i] = name
+			}
+		}
+	}
+	for _, u := range t.Uniques {
+		rename(u)
+	}
+	for _, k := range t.Keys {
+		rename(k.Cols)
+	}
+	eachFK(tables, fks, func(fk *FK, src *Table) {
+		if src == t {
+			rename(fk.SrcCols)
+		}
+		if fk.DstSchema == t.Schema && fk.DstTable == t.Name {
+			rename(fk.DstCols)
+		}
+	})
+}
+
+// renameTable moves t to a new name, updating the foreign keys on it and the
+// ones pointing at it.
+func renameTable(tables map[string]*Table, fks []FK, t *Table, sch, name string) {
+	eachFK(tables, fks, func(fk *FK, _ *Table) {
+		if fk.SrcSchema == t.Schema && fk.SrcTable == t.Name {
+			fk.SrcSchema, fk.SrcTable = sch, name
+		}
+		if fk.DstSchema == t.Schema && fk.DstTable == t.Name {
+			fk.DstSchema, fk.DstTable = sch, name
+		}
+	})
+	delete(tables, key(t.Schema, t.Name))
+	t.Schema, t.Name = sch, name
+	tables[key(sch, name)] = t
+}
+
+// eachFK calls f with every foreign key, table-level and on columns, and the
+// table a column-level one is on.
+func eachFK(tables map[string]*Table, fks []FK, f func(fk *FK, src *Table)) {
+	for i := range fks {
+		f(&fks[i], tables[key(fks[i].SrcSchema, fks[i].SrcTable)])
+	}
+	for _, t := range tables {
+		for i := range t.Cols {
+			if fk := t.Cols[i].ForeignKey; fk != nil {
+				f(fk, t)
+			}
+		}
+	}
+}
+
+func tableLabel(schema, name string) string {
+	if name == "" {
+		return ""
+	}
+	if schema == "" || schema == "public" {
+		return name
+	}
+	return schema + "." + name
+}
+
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+		return fmt.Sprintf("%d %s", n, noun)
+	case strings.HasSuffix(noun, "y"):
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(noun, "y"))
+	default:
+		return fmt.Sprintf("%d %ss", n, noun)
+	}
+}
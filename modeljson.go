@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSON forms of the model, for outputs that carry schema metadata and for the
+// model snapshot other tools can produce and consume.
+
+// modelVersion is bumped on any incompatible change to the snapshot format.
+const modelVersion = 1
+
+type jsonModel struct {
+	Version int         `json:"version"`
+	Engine  string      `json:"engine,omitempty"`
+	Tables  []jsonTable `json:"tables"`
+	Views   []jsonView  `json:"views"`
+	Types   []jsonType  `json:"types"`
+}
+
+type jsonColumn struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	PrimaryKey bool    `json:"primary_key,omitempty"`
+	Unique     bool    `json:"unique,omitempty"`
+	NotNull    bool    `json:"not_null,omitempty"`
+	ForeignKey *jsonFK `json:"foreign_key,omitempty"`
+	jsonProvenance
+}
+
+// jsonProvenance is where an object was created and every location that
+// later altered it.
+type jsonProvenance struct {
+	Created *jsonLocation  `json:"created,omitempty"`
+	Altered []jsonLocation `json:"altered,omitempty"`
+}
+
+type jsonLocation struct {
+	File string `json:"file"`
+	Line int    `json:"line,omitempty"`
+}
+
+type jsonFK struct {
+	Name       string        `json:"name,omitempty"`
+	Columns    []string      `json:"columns,omitempty"`
+	RefSchema  string        `json:"ref_schema,omitempty"`
+	RefTable   string        `json:"ref_table"`
+	RefColumns []string      `json:"ref_columns,omitempty"`
+	Created    *jsonLocation `json:"created,omitempty"`
+}
+
+// jsonKey is a named primary key or unique constraint, kept so a later
+// migration can drop it by name.
+type jsonKey struct {
+	Name    string   `json:"name"`
+	Primary bool     `json:"primary,omitempty"`
+	Columns []string `json:"columns"`
+}
+
+type jsonConstraint struct {
+	Name        string        `json:"name,omitempty"`
+	Type        string        `json:"type"`
+	Description string        `json:"description"`
+	Created     *jsonLocation `json:"created,omitempty"`
+}
+
+type jsonTable struct {
+	Schema      string           `json:"schema,omitempty"`
+	Name        string           `json:"name"`
+	Columns     []jsonColumn     `json:"columns"`
+	Constraints []jsonConstraint `json:"constraints,omitempty"`
+	// Uniques are the multi-column unique constraints.
+	Uniques [][]string `json:"uniques,omitempty"`
+	// ForeignKeys are the table-level, possibly multi-column, foreign keys.
+	ForeignKeys []jsonFK  `json:"foreign_keys,omitempty"`
+	Keys        []jsonKey `json:"keys,omitempty"`
+	jsonProvenance
+}
+
+type jsonView struct {
+	Schema  string       `json:"schema,omitempty"`
+	Name    string       `json:"name"`
+	Query   string       `json:"query,omitempty"`
+	Columns []jsonColumn `json:"columns"`
+	jsonProvenance
+}
+
+type jsonType struct {
+	Schema    string       `json:"schema,omitempty"`
+	Name      string       `json:"name"`
+	Kind      string       `json:"kind"`
+	Values    []string     `json:"values,omitempty"`
+	BaseType  string       `json:"base_type,omitempty"`
+	Check     string       `json:"check,omitempty"`
+	Columns   []jsonColumn `json:"columns,omitempty"`
+	Collation string       `json:"collation,omitempty"`
+	Default   string       `json:"default,omitempty"`
+	NotNull   bool         `json:"not_null,omitempty"`
+	jsonProvenance
+}
+
+func toJSONLocation(l *Location) *jsonLocation {
+	if l == nil {
+		return nil
+	}
+	return &jsonLocation{File: filepath.ToSlash(l.File), Line: l.Line}
+}
+
+func toJSONProvenance(created *Location, altered []*Location) jsonProvenance {
+	p := jsonProvenance{Created: toJSONLocation(created)}
+	for _, l := range altered {
+		p.Altered = append(p.Altered, *toJSONLocation(l))
+	}
+	return p
+}
+
+func fromJSONLocation(l *jsonLocation) *Location {
+	if l == nil {
+		return nil
+	}
+	return &Location{File: l.File, Line: l.Line}
+}
+
+func (p jsonProvenance) locations() (*Location, []*Location) {
+	var altered []*Location
+	for i := range p.Altered {
+		altered = append(altered, fromJSONLocation(&p.Altered[i]))
+	}
+	return fromJSONLocation(p.Created), altered
+}
+
+func toJSONFK(fk *FK) *jsonFK {
+	if fk == nil {
+		return nil
+	}
+	return &jsonFK{Name: fk.Name, Columns: fk.SrcCols, RefSchema: fk.DstSchema, RefTable: fk.DstTable, RefColumns: fk.DstCols, Created: toJSONLocation(fk.Created)}
+}
+
+func toJSONColumns(cols []Column) []jsonColumn {
+	out := make([]jsonColumn, 0, len(cols))
+	for _, c := range cols {
+		out = append(out, jsonColumn{
+			Name:           c.Name,
+			Type:           c.Type,
+			PrimaryKey:     c.PrimaryKey,
+			Unique:         c.Unique,
+			NotNull:        c.NotNull,
+			ForeignKey:     toJSONFK(c.ForeignKey),
+			jsonProvenance: toJSONProvenance(c.Created, c.Altered),
+		})
+	}
+	return out
+}
+
+func toJSONTable(t *Table) *jsonTable {
+	jt := &jsonTable{Schema: t.Schema, Name: t.Name, Columns: toJSONColumns(t.Cols), Uniques: t.Uniques, jsonProvenance: toJSONProvenance(t.Created, t.Altered)}
+	for _, c := range t.Constraints {
+		jt.Constraints = append(jt.Constraints, jsonConstraint{Name: c.Name, Type: c.Type, Description: c.Description, Created: toJSONLocation(c.Created)})
+	}
+	for _, name := range sortedKeys(t.Keys) {
+		k := t.Keys[name]
+		jt.Keys = append(jt.Keys, jsonKey{Name: name, Primary: k.Primary, Columns: k.Cols})
+	}
+	return jt
+}
+
+func toJSONView(v *View) *jsonView {
+	return &jsonView{Schema: v.Schema, Name: v.Name, Query: v.Query, Columns: toJSONColumns(v.Cols), jsonProvenance: toJSONProvenance(v.Created, v.Altered)}
+}
+
+func toJSONType(ct *CustomType) *jsonType {
+	return &jsonType{
+		Schema:         ct.Schema,
+		Name:           ct.Name,
+		Kind:           ct.TypeKind,
+		Values:         ct.Values,
+		BaseType:       ct.BaseType,
+		Check:          ct.Check,
+		Columns:        toJSONColumns(ct.Cols),
+		Collation:      ct.Collation,
+		Default:        ct.Default,
+		NotNull:        ct.NotNull,
+		jsonProvenance: toJSONProvenance(ct.Created, ct.Altered),
+	}
+}
+
+func fromJSONFK(fk *jsonFK) *FK {
+	if fk == nil {
+		return nil
+	}
+	return &FK{Name: fk.Name, SrcCols: fk.Columns, DstSchema: fk.RefSchema, DstTable: fk.RefTable, DstCols: fk.RefColumns, Created: fromJSONLocation(fk.Created)}
+}
+
+func fromJSONColumns(cols []jsonColumn) []Column {
+	var out []Column
+	for _, c := range cols {
+		col := Column{
+			Name:       c.Name,
+			Type:       c.Type,
+			PrimaryKey: c.PrimaryKey,
+			Unique:     c.Unique,
+			NotNull:    c.NotNull,
+			ForeignKey: fromJSONFK(c.ForeignKey),
+		}
+		col.Created, col.Altered = c.locations()
+		out = append(out, col)
+	}
+	return out
+}
+
+// modelSnapshot converts the schema into its snapshot form, sorted by key.
+// Table-level FKs are listed under the table that declared them.
+func modelSnapshot(s *Schema) jsonModel {
+	m := jsonModel{
+		Version: modelVersion,
+		Engine:  s.Engine,
+		Tables:  []jsonTable{},
+		Views:   []jsonView{},
+		Types:   []jsonType{},
+	}
+	owned := map[*Table][]jsonFK{}
+	for _, fk := range s.FKs {
+		if t := s.fkOwner(fk); t != nil {
+			owned[t] = append(owned[t], *toJSONFK(&fk))
+		}
+	}
+	for _, k := range sortedKeys(s.Tables) {
+		jt := toJSONTable(s.Tables[k])
+		jt.ForeignKeys = owned[s.Tables[k]]
+		m.Tables = append(m.Tables, *jt)
+	}
+	for _, k := range sortedKeys(s.Views) {
+		m.Views = append(m.Views, *toJSONView(s.Views[k]))
+	}
+	for _, k := range sortedKeys(s.Types) {
+		m.Types = append(m.Types, *toJSONType(s.Types[k]))
+	}
+	return m
+}
+
+// schemaFromSnapshot is the inverse of modelSnapshot.
+func schemaFromSnapshot(m jsonModel) (*Schema, error) {
+	if m.Version != modelVersion {
+		return nil, fmt.Errorf("unsupported model version %d, expected %d", m.Version, modelVersion)
+	}
+	engine := m.Engine
+	if engine == "" {
+		engine = enginePostgreSQL
+	}
+	s := newSchema(engine)
+	for _, jt := range m.Tables {
+		if jt.Name == "" {
+			return nil, fmt.Errorf("table without a name")
+		}
+		t := ensureTable(s.Tables, jt.Schema, jt.Name)
+		t.Cols = fromJSONColumns(jt.Columns)
+		t.Uniques = jt.Uniques
+		t.Created, t.Altered = jt.locations()
+		for _, c := range jt.Constraints {
+			t.Constraints = append(t.Constraints, TableConstraint{Name: c.Name, Type: c.Type, Description: c.Description, Created: fromJSONLocation(c.Created)})
+		}
+		for _, k := range jt.Keys {
+			nameKey(t, k.Name, k.Primary, k.Columns)
+		}
+		for _, fk := range jt.ForeignKeys {
+			f := fromJSONFK(&fk)
+			f.SrcSchema, f.SrcTable = t.Schema, t.Name
+			s.FKs = append(s.FKs, *f)
+		}
+	}
+	for _, jv := range m.Views {
+		v := &View{Schema: jv.Schema, Name: jv.Name, Query: jv.Query, Cols: fromJSONColumns(jv.Columns)}
+		v.Created, v.Altered = jv.locations()
+		s.Views[key(jv.Schema, jv.Name)] = v
+	}
+	for _, jt := range m.Types {
+		ct := &CustomType{
+			Schema:    jt.Schema,
+			Name:      jt.Name,
+			TypeKind:  jt.Kind,
+			Values:    jt.Values,
+			BaseType:  jt.BaseType,
+			Check:     jt.Check,
+			Cols:      fromJSONColumns(jt.Columns),
+			Collation: jt.Collation,
+			Default:   jt.Default,
+			NotNull:   jt.NotNull,
+		}
+		ct.Created, ct.Altered = jt.locations()
+		s.Types[key(jt.Schema, jt.Name)] = ct
+	}
+	return s, nil
+}
+
+// cloneSchema deep copies a schema by way of its snapshot.
+func cloneSchema(s *Schema) *Schema {
+	c, _ := schemaFromSnapshot(modelSnapshot(s))
+	c.Engine = s.Engine
+	return c
+}
+
+func encodeModelJSON(s *Schema) (string, error) {
+	b, err := json.MarshalIndent(modelSnapshot(s), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode model: %w", err)
+	}
+	return string(b) + "\n", nil
+}
+
+// encodeModelYAML writes the same document as encodeModelJSON. It goes
+// through the JSON encoding so both share one set of field names and order.
+func encodeModelYAML(s *Schema) (string, error) {
+	j, err := encodeModelJSON(s)
+	if err != nil {
+		return "", err
+	}
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(j), &n); err != nil {
+		return "", fmt.Errorf("failed to encode model: %w", err)
+	}
+	blockStyle(&n)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&n); err != nil {
+		return "", fmt.Errorf("failed to encode model: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// blockStyle drops the flow style YAML nodes decoded from JSON come with.
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// readModel loads a model snapshot, as YAML when the extension says so and as
+// JSON otherwise.
+func readModel(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var v any
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("failed to parse model %s: %w", path, err)
+		}
+		if b, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("failed to parse model %s: %w", path, err)
+		}
+	}
+
+	var m jsonModel
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse model %s: %w", path, err)
+	}
+	s, err := schemaFromSnapshot(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load model %s: %w", path, err)
+	}
+	return s, nil
+}
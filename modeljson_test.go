@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModelRoundTrip(t *testing.T) {
+	for name, s := range map[string]*Schema{
+		"testdata": testdataSchema(t),
+		"members":  parseTestSQL(t, membersSQL),
+	} {
+		for _, ext := range []string{"json", "yaml"} {
+			t.Run(name+"."+ext, func(t *testing.T) {
+				encode := encodeModelJSON
+				if ext == "yaml" {
+					encode = encodeModelYAML
+				}
+				want, err := encode(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join(t.TempDir(), "model."+ext)
+				if err := os.WriteFile(path, []byte(want), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				r, err := readModel(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := encode(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("snapshot changed on the way back\ngot:\n%s\nwant:\n%s", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestModelKeepsKeys(t *testing.T) {
+	s := cloneSchema(parseTestSQL(t, membersSQL))
+	pm := s.Tables["project_members"]
+	if want := [][]string{{"project_id", "user_id"}}; !reflect.DeepEqual(pm.Uniques, want) {
+		t.Errorf("uniques %q, want %q", pm.Uniques, want)
+	}
+	if len(s.FKs) != 1 || s.fkOwner(s.FKs[0]) != pm {
+		t.Errorf("FKs %+v, want one declared on project_members", s.FKs)
+	}
+	if fk := pm.Cols[0].ForeignKey; fk == nil || fk.DstTable != "projects" {
+		t.Errorf("project_id FK %+v, want one to projects", fk)
+	}
+}
+
+// TestModelKeepsConstraintNames drops named constraints from a schema that
+// went through a snapshot, as diff and timeline do after cloning.
+func TestModelKeepsConstraintNames(t *testing.T) {
+	s := parseTestSQL(t, `
+CREATE TABLE users (id int CONSTRAINT users_pk PRIMARY KEY, email text, name text);
+ALTER TABLE users ADD CONSTRAINT users_email_name UNIQUE (email, name);
+CREATE TABLE posts (
+	id int PRIMARY KEY,
+	user_id int CONSTRAINT posts_user REFERENCES users (id),
+	editor_id int,
+	CONSTRAINT posts_editor FOREIGN KEY (editor_id) REFERENCES users (id)
+);
+`)
+	j, err := encodeModelJSON(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := os.WriteFile(path, []byte(j), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := readModel(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drop := `
+ALTER TABLE posts DROP CONSTRAINT posts_user, DROP CONSTRAINT posts_editor;
+ALTER TABLE users DROP CONSTRAINT users_email_name, DROP CONSTRAINT users_pk;
+`
+	if err := parseSQL("2.sql", []byte(drop), r.Tables, &r.FKs, r.Views, r.Types); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.FKs) != 0 {
+		t.Errorf("FKs %+v, want none", r.FKs)
+	}
+	if fk := r.Tables["posts"].Cols[1].ForeignKey; fk != nil {
+		t.Errorf("user_id FK %+v, want none", fk)
+	}
+	users := r.Tables["users"]
+	if len(users.Uniques) != 0 || users.Cols[0].PrimaryKey {
+		t.Errorf("users keeps its keys: uniques %q, id primary key %v", users.Uniques, users.Cols[0].PrimaryKey)
+	}
+}
+
+func TestReadModelErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, wantErr string
+	}{
+		{name: "newer version", file: "m.json", content: `{"version": 2, "tables": []}`, wantErr: "unsupported model version 2"},
+		{name: "unknown field", file: "m.json", content: `{"version": 1, "tabels": []}`, wantErr: `unknown field "tabels"`},
+		{name: "unnamed table", file: "m.yaml", content: "version: 1\ntables:\n  - columns: []\n", wantErr: "table without a name"},
+		{name: "bad yaml", file: "m.yml", content: "version: [", wantErr: "failed to parse model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readModel(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+)
+
+// Options configures what gets rendered and where it's written. In plugin mode
+// it's decoded from the `options` block of a sqlc.yaml codegen entry.
+type Options struct {
+	// Input selects where the schema comes from in plugin mode: "files"
+	// re-parses the schema files from sqlc.yaml, "catalog" uses the catalog
+	// sqlc already built and "auto" uses the files when they're reachable and
+	// falls back to the catalog. "model" reads the model snapshot at Model.
+	Input string `json:"input"`
+	// Model is the path to a JSON or YAML model snapshot, as written by the
+	// model_json and model_yaml outputs.
+	Model string `json:"model"`
+	// Until stops applying migrations after the given file (base name or
+	// path) or version (the number a file name starts with), to render the
+	// schema as it was at that point.
+	Until string `json:"until"`
+	// Layout is the d2 layout engine, "elk" or "dagre".
+	Layout string `json:"layout"`
+	// Theme is a d2 theme name (case-insensitive) or numeric theme ID.
+	Theme string `json:"theme"`
+	// Detail controls how much of each table is drawn: "full" shows every
+	// column and table constraint, "keys" only PK/UNQ/FK columns and "tables"
+	// only the table names.
+	Detail string `json:"detail"`
+	// Include and Exclude are glob patterns matched against qualified object
+	// names, e.g. "users" or "audit.*". Exclude wins over Include.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// QueryUsage annotates each table with the sqlc queries that read and
+	// write it, and fades the tables and columns none of them use.
+	QueryUsage bool `json:"query_usage"`
+	// Link is a URL template every table, view and type in the SVG links to.
+	// {name}, {file} and {line} are the object's name and the migration that
+	// created it, {page} its page in the html output and {anchor} its
+	// heading in the dictionary output, e.g.
+	// "https://github.com/org/repo/blob/main/{file}#L{line}".
+	Link string `json:"link"`
+	// Tooltips adds a summary of each table, view and type to the SVG.
+	Tooltips bool `json:"tooltips"`
+	// Outputs are the file names to write, relative to the codegen out
+	// directory. An empty name disables that output.
+	Outputs Outputs `json:"outputs"`
+}
+
+type Outputs struct {
+	SVG string `json:"svg"`
+	D2  string `json:"d2"`
+	// Mermaid is an erDiagram of the tables, views and foreign keys.
+	Mermaid string `json:"mermaid"`
+	// DBML is the schema in dbdiagram.io's markup.
+	DBML string `json:"dbml"`
+	// PlantUML (IE notation) and DOT (Graphviz) for doc pipelines without d2.
+	PlantUML string `json:"plantuml"`
+	DOT      string `json:"dot"`
+	// DrawIO is the laid out d2 diagram as a diagrams.net file.
+	DrawIO string `json:"drawio"`
+	// LayoutJSON is every node and edge of the laid out d2 diagram with its
+	// coordinates and model metadata.
+	LayoutJSON string `json:"layout_json"`
+	// ModelJSON and ModelYAML are a versioned snapshot of the parsed model
+	// that can be read back with the "model" input.
+	ModelJSON string `json:"model_json"`
+	ModelYAML string `json:"model_yaml"`
+	// Dictionary is a Markdown data dictionary of every table, view and type.
+	Dictionary string `json:"dictionary"`
+	// HTML is a directory to write a static documentation site to.
+	HTML string `json:"html"`
+	// Timeline is an animated SVG stepping through the schema after each
+	// migration file, with what it added highlighted.
+	Timeline string `json:"timeline"`
+	// UnusedMarkdown and UnusedJSON report the tables and columns no query
+	// references.
+	UnusedMarkdown string `json:"unused_markdown"`
+	UnusedJSON     string `json:"unused_json"`
+	// QueryDiagrams is a directory to write a diagram per query to, showing
+	// the tables it touches and the columns it joins on.
+	QueryDiagrams string `json:"query_diagrams"`
+}
+
+func (o Outputs) names() []string {
+	return []string{o.SVG, o.D2, o.Mermaid, o.DBML, o.PlantUML, o.DOT, o.DrawIO, o.LayoutJSON, o.ModelJSON, o.ModelYAML, o.Dictionary, o.HTML, o.Timeline, o.UnusedMarkdown, o.UnusedJSON, o.QueryDiagrams}
+}
+
+// formats maps the diagram formats --format picks from to their outputs.
+func (o *Outputs) formats() map[string]*string {
+	return map[string]*string{
+		"svg":        &o.SVG,
+		"d2":         &o.D2,
+		"mermaid":    &o.Mermaid,
+		"dbml":       &o.DBML,
+		"plantuml":   &o.PlantUML,
+		"dot":        &o.DOT,
+		"drawio":     &o.DrawIO,
+		"layout":     &o.LayoutJSON,
+		"json":       &o.ModelJSON,
+		"yaml":       &o.ModelYAML,
+		"dictionary": &o.Dictionary,
+		"html":       &o.HTML,
+		"timeline":   &o.Timeline,
+	}
+}
+
+// formatFiles are the file names formats picked with --format are written to
+// when the options don't name them.
+var formatFiles = map[string]string{
+	"svg":        "schema.svg",
+	"d2":         "schema.d2",
+	"mermaid":    "schema.mmd",
+	"dbml":       "schema.dbml",
+	"plantuml":   "schema.puml",
+	"dot":        "schema.dot",
+	"drawio":     "schema.drawio",
+	"layout":     "layout.json",
+	"json":       "schema.json",
+	"yaml":       "schema.yaml",
+	"dictionary": "schema.md",
+	"html":       "site",
+	"timeline":   "timeline.svg",
+}
+
+// selectFormats enables exactly the given diagram formats, keeping the file
+// names already set for them.
+func (o *Outputs) selectFormats(formats []string) error {
+	want := map[string]bool{}
+	for _, f := range formats {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if _, ok := formatFiles[f]; !ok {
+			return fmt.Errorf("unknown format %q, must be one of %s", f, strings.Join(sortedKeys(formatFiles), ", "))
+		}
+		want[f] = true
+	}
+	for f, out := range o.formats() {
+		switch {
+		case !want[f]:
+			*out = ""
+		case *out == "":
+			*out = formatFiles[f]
+		}
+	}
+	return nil
+}
+
+const (
+	inputAuto    = "auto"
+	inputFiles   = "files"
+	inputCatalog = "catalog"
+	inputModel   = "model"
+)
+
+const (
+	detailFull   = "full"
+	detailKeys   = "keys"
+	detailTables = "tables"
+)
+
+func defaultOptions() Options {
+	return Options{
+		Input:  inputAuto,
+		Layout: "elk",
+		Theme:  d2themescatalog.NeutralGrey.Name,
+		Detail: detailFull,
+		Outputs: Outputs{
+			SVG: defaultSVG,
+			D2:  "schema.d2",
+		},
+	}
+}
+
+// parseOptions decodes plugin options on top of the defaults. Unknown keys are
+// rejected so typos in sqlc.yaml don't silently fall back to defaults.
+func parseOptions(b []byte) (Options, error) {
+	opts := defaultOptions()
+	if len(bytes.TrimSpace(b)) == 0 {
+		return opts, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return Options{}, fmt.Errorf("invalid plugin options: %w", err)
+	}
+	if err := opts.validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid plugin options: %w", err)
+	}
+	return opts, nil
+}
+
+func (o Options) validate() error {
+	switch o.Input {
+	case inputAuto, inputFiles, inputCatalog:
+	case inputModel:
+		if o.Model == "" {
+			return fmt.Errorf("input %s needs a model path", inputModel)
+		}
+	default:
+		return fmt.Errorf("unknown input %q, must be one of %s, %s, %s, %s", o.Input, inputAuto, inputFiles, inputCatalog, inputModel)
+	}
+	if o.Until != "" && (o.Input == inputCatalog || o.Input == inputModel) {
+		return fmt.Errorf("until needs migration files, not input %s", o.Input)
+	}
+
+	switch o.Layout {
+	case "elk", "dagre":
+	default:
+		return fmt.Errorf("unknown layout %q, must be one of elk, dagre", o.Layout)
+	}
+
+	switch o.Detail {
+	case detailFull, detailKeys, detailTables:
+	default:
+		return fmt.Errorf("unknown detail %q, must be one of %s, %s, %s", o.Detail, detailFull, detailKeys, detailTables)
+	}
+
+	if _, err := findTheme(o.Theme); err != nil {
+		return err
+	}
+
+	for _, p := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid filter pattern %q: %w", p, err)
+		}
+	}
+
+	var outputs int
+	for _, name := range o.Outputs.names() {
+		if name == "" {
+			continue
+		}
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("output %q must be relative to the out directory", name)
+		}
+		outputs++
+	}
+	if outputs == 0 {
+		return fmt.Errorf("no outputs enabled")
+	}
+
+	return nil
+}
+
+// expandLink fills in the Link template for an object, returning "" when it
+// needs a location the object doesn't have. d2 takes a relative link such as
+// "tables/users.html" for a link to one of its boards and drops it, so those
+// get a "./" prefix.
+func (o Options) expandLink(kind, label string, loc *Location) string {
+	if o.Link == "" {
+		return ""
+	}
+	file, line := "", ""
+	if loc != nil {
+		file, line = filepath.ToSlash(filepath.Clean(loc.File)), strconv.Itoa(loc.Line)
+	} else if strings.Contains(o.Link, "{file}") || strings.Contains(o.Link, "{line}") {
+		return ""
+	}
+	link := strings.NewReplacer(
+		"{name}", label,
+		"{file}", file,
+		"{line}", line,
+		"{page}", sitePagePath(kind, label),
+		"{anchor}", mdAnchor(label),
+	).Replace(o.Link)
+	if u, err := url.Parse(link); err == nil && u.Scheme == "" && link != "" && !strings.ContainsRune("/.#", rune(link[0])) {
+		link = "./" + link
+	}
+	return link
+}
+
+// findTheme looks up a d2 theme by name or ID.
+func findTheme(s string) (d2themes.Theme, error) {
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if t := d2themescatalog.Find(id); t.ID == id && t.Name != "" {
+			return t, nil
+		}
+		return d2themes.Theme{}, fmt.Errorf("unknown theme id %d", id)
+	}
+	for _, t := range append(append([]d2themes.Theme{}, d2themescatalog.LightCatalog...), d2themescatalog.DarkCatalog...) {
+		if strings.EqualFold(t.Name, s) {
+			return t, nil
+		}
+	}
+	return d2themes.Theme{}, fmt.Errorf("unknown theme %q", s)
+}
+
+// included reports whether the qualified name passes the include/exclude
+// filters.
+func (o Options) included(name string) bool {
+	for _, p := range o.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, p := range o.Include {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFilters drops every table, view and custom type that doesn't pass the
+// include/exclude filters.
+func (o Options) applyFilters(s *Schema) {
+	for k, t := range s.Tables {
+		if !o.included(tableLabel(t.Schema, t.Name)) {
+			delete(s.Tables, k)
+		}
+	}
+	for k, v := range s.Views {
+		if !o.included(tableLabel(v.Schema, v.Name)) {
+			delete(s.Views, k)
+		}
+	}
+	for k, ct := range s.Types {
+		if !o.included(tableLabel(ct.Schema, ct.Name)) {
+			delete(s.Types, k)
+		}
+	}
+}
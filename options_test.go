@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		check   func(Options) bool
+		wantErr string
+	}{
+		{
+			name: "empty uses the defaults",
+			in:   "",
+			check: func(o Options) bool {
+				return o.Layout == "elk" && o.Detail == detailFull && o.Outputs.D2 == "schema.d2"
+			},
+		},
+		{
+			name: "overrides keep the other defaults",
+			in:   `{"layout": "dagre", "outputs": {"mermaid": "er.mmd"}}`,
+			check: func(o Options) bool {
+				return o.Layout == "dagre" && o.Outputs.Mermaid == "er.mmd" && o.Outputs.D2 == "schema.d2"
+			},
+		},
+		{
+			name: "outputs can be disabled",
+			in:   `{"outputs": {"svg": "", "d2": "", "dbml": "schema.dbml"}}`,
+			check: func(o Options) bool {
+				return o.Outputs.SVG == "" && o.Outputs.D2 == "" && o.Outputs.DBML == "schema.dbml"
+			},
+		},
+		{
+			name:  "theme by id",
+			in:    `{"theme": "0"}`,
+			check: func(o Options) bool { return o.Theme == "0" },
+		},
+		{name: "unknown key", in: `{"layuot": "dagre"}`, wantErr: `unknown field "layuot"`},
+		{name: "unknown layout", in: `{"layout": "grid"}`, wantErr: `unknown layout "grid"`},
+		{name: "unknown detail", in: `{"detail": "some"}`, wantErr: `unknown detail "some"`},
+		{name: "unknown theme", in: `{"theme": "no such theme"}`, wantErr: `unknown theme "no such theme"`},
+		{name: "unknown input", in: `{"input": "db"}`, wantErr: `unknown input "db"`},
+		{name: "model input without a model", in: `{"input": "model"}`, wantErr: "input model needs a model path"},
+		{name: "until with the catalog", in: `{"input": "catalog", "until": "3"}`, wantErr: "until needs migration files"},
+		{name: "bad filter", in: `{"include": ["["]}`, wantErr: `invalid filter pattern "["`},
+		{name: "absolute output", in: `{"outputs": {"svg": "/tmp/schema.svg"}}`, wantErr: "must be relative to the out directory"},
+		{name: "output outside out", in: `{"outputs": {"svg": "../schema.svg"}}`, wantErr: "must be relative to the out directory"},
+		{name: "no outputs", in: `{"outputs": {"svg": "", "d2": ""}}`, wantErr: "no outputs enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseOptions([]byte(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(opts) {
+				t.Errorf("unexpected options %+v", opts)
+			}
+		})
+	}
+}
+
+func TestExpandLink(t *testing.T) {
+	loc := &Location{File: "db/./migrations/1.sql", Line: 7}
+	tests := []struct {
+		link, kind, label string
+		loc               *Location
+		want              string
+	}{
+		{link: "", kind: "table", label: "users", loc: loc, want: ""},
+		{link: "https://x/blob/main/{file}#L{line}", kind: "table", label: "users", loc: loc, want: "https://x/blob/main/db/migrations/1.sql#L7"},
+		{link: "https://x/blob/main/{file}#L{line}", kind: "table", label: "users", want: ""},
+		{link: "docs/{page}", kind: "view", label: "audit.recent", want: "./docs/views/audit.recent.html"},
+		{link: "dictionary.md#{anchor}", kind: "enum", label: "audit.kind", loc: loc, want: "./dictionary.md#auditkind"},
+		{link: "/search?q={name}", kind: "domain", label: "email", want: "/search?q=email"},
+		{link: "../{page}", kind: "table", label: "users", want: "../tables/users.html"},
+		{link: "#{anchor}", kind: "table", label: "users", want: "#users"},
+	}
+	for _, tt := range tests {
+		o := Options{Link: tt.link}
+		if got := o.expandLink(tt.kind, tt.label, tt.loc); got != tt.want {
+			t.Errorf("expandLink(%q) of %s %s = %q, want %q", tt.link, tt.kind, tt.label, got, tt.want)
+		}
+	}
+}
@@ -3,42 +3,96 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"os"
 	"strings"
 
 	pgquery "github.com/pganalyze/pg_query_go/v6"
 )
 
-func parseFiles(paths []string) (tables map[string]*Table, tableLevelFKs *[]FK, views map[string]*View, customTypes map[string]*CustomType, err error) {
-	tables = map[string]*Table{}
-	tableLevelFKs = &[]FK{}
-	views = map[string]*View{}
-	customTypes = map[string]*CustomType{}
+const (
+	enginePostgreSQL = "postgresql"
+	engineMySQL      = "mysql"
+	engineSQLite     = "sqlite"
+)
+
+func parseFiles(paths []string, engine string, read readFunc) (*Schema, error) {
+	s := newSchema(engine)
 	for _, path := range paths {
-		err := parseSQL(path, tables, tableLevelFKs, views, customTypes)
-		if err != nil {
-			return nil, nil, nil, nil, err
+		if err := parseFile(s, path, read); err != nil {
+			return nil, err
 		}
 	}
-	return tables, tableLevelFKs, views, customTypes, nil
+	return s, nil
 }
 
-func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views map[string]*View, customTypes map[string]*CustomType) error {
-	b, err := os.ReadFile(path)
+// readFunc reads a migration file, from disk (os.ReadFile) or elsewhere.
+type readFunc func(path string) ([]byte, error)
+
+// parseFile applies one migration file to the schema.
+func parseFile(s *Schema, path string, read readFunc) error {
+	up, err := readMigration(path, read)
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", path, err)
+		return err
+	}
+	switch s.Engine {
+	case enginePostgreSQL, "":
+		return parseSQL(path, up, s.Tables, &s.FKs, s.Views, s.Types)
+	case engineMySQL, engineSQLite:
+		return parseDDL(path, up, s.Engine, s)
+	default:
+		return fmt.Errorf("unsupported engine %q", s.Engine)
+	}
+}
+
+// stmtLine returns the line a statement starts on, skipping the whitespace
+// and comments between offset and the statement itself.
+func stmtLine(src []byte, offset int) int {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	for offset < len(src) {
+		rest := src[offset:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			offset++
+		case bytes.HasPrefix(rest, []byte("--")):
+			if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+				offset += i + 1
+			} else {
+				offset = len(src)
+			}
+		case bytes.HasPrefix(rest, []byte("/*")):
+			if i := bytes.Index(rest, []byte("*/")); i >= 0 {
+				offset += i + 2
+			} else {
+				offset = len(src)
+			}
+		default:
+			return bytes.Count(src[:offset], []byte("\n")) + 1
+		}
+	}
+	return bytes.Count(src[:offset], []byte("\n")) + 1
+}
+
+// readMigration returns the "up" part of a tern migration file.
+func readMigration(path string, read readFunc) ([]byte, error) {
+	b, err := read(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
 	}
 
 	pieces := bytes.SplitN(b, []byte("---- create above / drop below ----"), 2)
-	up := pieces[0]
+	return pieces[0], nil
+}
 
-	res, err := pgquery.Parse(string(up))
+func parseSQL(path string, up []byte, tables map[string]*Table, tableLevelFKs *[]FK, views map[string]*View, customTypes map[string]*CustomType) error {
+	res, err := pgParse(string(up))
 	if err != nil {
 		return fmt.Errorf("failed to parse SQL in %s: %w", path, err)
 	}
 
 	for _, raw := range res.GetStmts() {
 		s := raw.GetStmt()
+		loc := &Location{File: path, Line: stmtLine(up, int(raw.GetStmtLocation()))}
 
 		if cs := s.GetCreateStmt(); cs != nil {
 			sch := getSchema(cs.GetRelation())
@@ -47,55 +101,18 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 				continue
 			}
 			t := ensureTable(tables, sch, tn)
+			if t.Created == nil {
+				t.Created = loc
+			} else {
+				t.Altered = alteredAt(t.Altered, t.Created, loc)
+			}
 
 			for _, elt := range cs.GetTableElts() {
 				if cd := elt.GetColumnDef(); cd != nil {
-					col := Column{Name: cd.GetColname(), Type: typeName(cd.GetTypeName())}
-					for _, rc := range cd.GetConstraints() {
-						c := rc.GetConstraint()
-						switch c.Contype {
-						case pgquery.ConstrType_CONSTR_PRIMARY:
-							col.PrimaryKey = true
-						case pgquery.ConstrType_CONSTR_UNIQUE:
-							col.Unique = true
-						case pgquery.ConstrType_CONSTR_FOREIGN:
-							dstS, dstT := pktable(c)
-							col.ForeignKey = &FK{
-								SrcCols:   []string{col.Name},
-								DstSchema: dstS, DstTable: dstT,
-								DstCols: nodeIdents(c.GetPkAttrs()),
-							}
-						}
-					}
-					t.Cols = upsertCol(t.Cols, col)
+					t.Cols = upsertCol(t.Cols, columnDef(t, cd, loc))
 				}
 				if c := elt.GetConstraint(); c != nil {
-					switch c.GetContype() {
-					case pgquery.ConstrType_CONSTR_PRIMARY:
-						for _, n := range nodeIdents(c.GetKeys()) {
-							markPK(t, n)
-						}
-					case pgquery.ConstrType_CONSTR_UNIQUE:
-						for _, n := range nodeIdents(c.GetKeys()) {
-							markUQ(t, n)
-						}
-					case pgquery.ConstrType_CONSTR_FOREIGN:
-						dstS, dstT := pktable(c)
-						*tableLevelFKs = append(*tableLevelFKs, FK{
-							SrcCols:   nodeIdents(c.GetFkAttrs()),
-							DstSchema: dstS, DstTable: dstT,
-							DstCols: nodeIdents(c.GetPkAttrs()),
-						})
-					case pgquery.ConstrType_CONSTR_CHECK:
-						if re := c.GetRawExpr(); re != nil {
-							constraint := TableConstraint{
-								Name:        c.GetConname(),
-								Type:        "CHECK",
-								Description: extractNodeConstraint(re),
-							}
-							t.Constraints = append(t.Constraints, constraint)
-						}
-					}
+					addConstraint(t, tableLevelFKs, c, loc)
 				}
 			}
 			continue
@@ -108,6 +125,7 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 				continue
 			}
 			t := ensureTable(tables, sch, tn)
+			t.Altered = alteredAt(t.Altered, t.Created, loc)
 			for _, n := range at.GetCmds() {
 				cmd := n.GetAlterTableCmd()
 				if cmd == nil {
@@ -115,26 +133,18 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 				}
 				switch cmd.GetSubtype() {
 				case pgquery.AlterTableType_AT_AddColumn:
-					// Handle ADD COLUMN
 					if cd := cmd.GetDef().GetColumnDef(); cd != nil {
-						col := Column{Name: cd.GetColname(), Type: typeName(cd.GetTypeName())}
-						for _, rc := range cd.GetConstraints() {
-							c := rc.GetConstraint()
-							switch c.Contype {
-							case pgquery.ConstrType_CONSTR_PRIMARY:
-								col.PrimaryKey = true
-							case pgquery.ConstrType_CONSTR_UNIQUE:
-								col.Unique = true
-							case pgquery.ConstrType_CONSTR_FOREIGN:
-								dstS, dstT := pktable(c)
-								col.ForeignKey = &FK{
-									SrcCols:   []string{col.Name},
-									DstSchema: dstS, DstTable: dstT,
-									DstCols: nodeIdents(c.GetPkAttrs()),
-								}
-							}
-						}
-						t.Cols = upsertCol(t.Cols, col)
+						t.Cols = upsertCol(t.Cols, columnDef(t, cd, loc))
+					}
+				case pgquery.AlterTableType_AT_AlterColumnType:
+					if c := findCol(t, cmd.GetName()); c != nil {
+						c.Type = typeName(cmd.GetDef().GetColumnDef().GetTypeName())
+						c.Altered = alteredAt(c.Altered, c.Created, loc)
+					}
+				case pgquery.AlterTableType_AT_SetNotNull, pgquery.AlterTableType_AT_DropNotNull:
+					if c := findCol(t, cmd.GetName()); c != nil {
+						c.NotNull = cmd.GetSubtype() == pgquery.AlterTableType_AT_SetNotNull
+						c.Altered = alteredAt(c.Altered, c.Created, loc)
 					}
 				case pgquery.AlterTableType_AT_DropColumn:
 					// Handle DROP COLUMN
@@ -142,59 +152,59 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 						t.Cols = removeCol(t.Cols, cmd.GetName())
 					}
 				case pgquery.AlterTableType_AT_AddConstraint:
-					con := cmd.GetDef().GetConstraint()
-					if con == nil {
-						continue
-					}
-					switch con.GetContype() {
-					case pgquery.ConstrType_CONSTR_PRIMARY:
-						for _, k := range nodeIdents(con.GetKeys()) {
-							markPK(tables[key(sch, tn)], k)
-						}
-					case pgquery.ConstrType_CONSTR_UNIQUE:
-						for _, k := range nodeIdents(con.GetKeys()) {
-							markUQ(tables[key(sch, tn)], k)
-						}
-					case pgquery.ConstrType_CONSTR_FOREIGN:
-						dstS, dstT := pktable(con)
-						*tableLevelFKs = append(*tableLevelFKs, FK{
-							SrcCols:   nodeIdents(con.GetFkAttrs()),
-							DstSchema: dstS, DstTable: dstT,
-							DstCols: nodeIdents(con.GetPkAttrs()),
-						})
-					case pgquery.ConstrType_CONSTR_CHECK:
-						if re := con.GetRawExpr(); re != nil {
-							constraint := TableConstraint{
-								Name:        con.GetConname(),
-								Type:        "CHECK",
-								Description: extractNodeConstraint(re),
-							}
-							t := tables[key(sch, tn)]
-							if t != nil {
-								t.Constraints = append(t.Constraints, constraint)
-							}
-						}
+					if con := cmd.GetDef().GetConstraint(); con != nil {
+						addConstraint(t, tableLevelFKs, con, loc)
 					}
+				case pgquery.AlterTableType_AT_DropConstraint:
+					dropConstraint(t, tableLevelFKs, cmd.GetName(), loc)
 				}
 			}
 		}
 
+		if rs := s.GetRenameStmt(); rs != nil {
+			// Handle ALTER TABLE ... RENAME
+			t := tables[key(getSchema(rs.GetRelation()), rs.GetRelation().GetRelname())]
+			if t == nil || rs.GetNewname() == "" || rs.GetRelationType() == pgquery.ObjectType_OBJECT_VIEW {
+				continue
+			}
+			switch rs.GetRenameType() {
+			case pgquery.ObjectType_OBJECT_TABLE:
+				renameTable(tables, *tableLevelFKs, t, t.Schema, rs.GetNewname())
+			case pgquery.ObjectType_OBJECT_COLUMN:
+				renameColumn(tables, *tableLevelFKs, t, rs.GetSubname(), rs.GetNewname(), loc)
+			case pgquery.ObjectType_OBJECT_TABCONSTRAINT:
+				renameConstraint(t, *tableLevelFKs, rs.GetSubname(), rs.GetNewname())
+			default:
+				continue
+			}
+			t.Altered = alteredAt(t.Altered, t.Created, loc)
+		}
+
 		if vs := s.GetViewStmt(); vs != nil {
 			// Handle CREATE VIEW
 			sch := getSchema(vs.GetView())
 			vn := vs.GetView().GetRelname()
 			if vn != "" {
 				view := &View{
-					Schema: sch,
-					Name:   vn,
+					Schema:  sch,
+					Name:    vn,
+					Created: loc,
 				}
 
 				// Try to extract columns from the SELECT statement
 				if query := vs.GetQuery(); query != nil {
 					cols := extractViewColumns(query)
 					view.Cols = cols
+					if q, err := pgDeparse(query); err == nil {
+						view.Query = q
+					}
 				}
 
+				if old := views[key(sch, vn)]; old != nil {
+					// CREATE OR REPLACE VIEW
+					view.Created = old.Created
+					view.Altered = alteredAt(old.Altered, old.Created, loc)
+				}
 				views[key(sch, vn)] = view
 			}
 		}
@@ -208,6 +218,7 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 					Schema:   sch,
 					Name:     tn,
 					TypeKind: "composite",
+					Created:  loc,
 				}
 
 				// Extract columns from composite type
@@ -221,7 +232,7 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 					}
 				}
 
-				customTypes[key(sch, tn)] = ct
+				setType(customTypes, ct, loc)
 			}
 		}
 
@@ -241,12 +252,37 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 						values = append(values, s.GetSval())
 					}
 				}
-				customTypes[key(sch, tn)] = &CustomType{
+				setType(customTypes, &CustomType{
 					Schema:   sch,
 					Name:     tn,
 					TypeKind: "enum",
 					Values:   values,
+					Created:  loc,
+				}, loc)
+			}
+		}
+
+		if aes := s.GetAlterEnumStmt(); aes != nil {
+			// Handle ALTER TYPE ... ADD VALUE
+			names := nodeIdents(aes.GetTypeName())
+			sch, tn := "", ""
+			if len(names) > 1 {
+				sch, tn = names[0], names[1]
+			} else if len(names) == 1 {
+				tn = names[0]
+			}
+			if ct := customTypes[key(sch, tn)]; ct != nil && ct.TypeKind == "enum" && aes.GetNewVal() != "" {
+				if aes.GetOldVal() == "" {
+					ct.Values = addEnumValue(ct.Values, aes.GetNewVal(), aes.GetNewValNeighbor(), aes.GetNewValIsAfter())
+				} else {
+					// RENAME VALUE
+					for i, v := range ct.Values {
+						if v == aes.GetOldVal() {
+							ct.Values[i] = aes.GetNewVal()
+						}
+					}
 				}
+				ct.Altered = alteredAt(ct.Altered, ct.Created, loc)
 			}
 		}
 
@@ -266,6 +302,7 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 					Name:     dn,
 					TypeKind: "domain",
 					BaseType: typeName(dds.GetTypeName()),
+					Created:  loc,
 				}
 
 				// Extract domain constraints
@@ -291,7 +328,7 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 					}
 				}
 
-				customTypes[key(sch, dn)] = ct
+				setType(customTypes, ct, loc)
 			}
 		}
 
@@ -360,6 +397,108 @@ func parseSQL(path string, tables map[string]*Table, tableLevelFKs *[]FK, views
 	return nil
 }
 
+// columnDef converts a column definition of t, with its inline constraints.
+func columnDef(t *Table, cd *pgquery.ColumnDef, loc *Location) Column {
+	col := Column{Name: cd.GetColname(), Type: typeName(cd.GetTypeName()), Created: loc}
+	for _, rc := range cd.GetConstraints() {
+		c := rc.GetConstraint()
+		switch c.Contype {
+		case pgquery.ConstrType_CONSTR_PRIMARY:
+			col.PrimaryKey = true
+			nameKey(t, conName(t, c, nil, "pkey"), true, []string{col.Name})
+		case pgquery.ConstrType_CONSTR_UNIQUE:
+			col.Unique = true
+			nameKey(t, conName(t, c, []string{col.Name}, "key"), false, []string{col.Name})
+		case pgquery.ConstrType_CONSTR_NOTNULL:
+			col.NotNull = true
+		case pgquery.ConstrType_CONSTR_FOREIGN:
+			dstS, dstT := pktable(c)
+			col.ForeignKey = &FK{
+				Name:      conName(t, c, []string{col.Name}, "fkey"),
+				SrcCols:   []string{col.Name},
+				DstSchema: dstS, DstTable: dstT,
+				DstCols: nodeIdents(c.GetPkAttrs()),
+				Created: loc,
+			}
+		}
+	}
+	return col
+}
+
+// addConstraint applies a table constraint to t.
+func addConstraint(t *Table, tableLevelFKs *[]FK, c *pgquery.Constraint, loc *Location) {
+	switch c.GetContype() {
+	case pgquery.ConstrType_CONSTR_PRIMARY:
+		keys := nodeIdents(c.GetKeys())
+		for _, k := range keys {
+			markPK(t, k, loc)
+		}
+		nameKey(t, conName(t, c, nil, "pkey"), true, keys)
+	case pgquery.ConstrType_CONSTR_UNIQUE:
+		keys := nodeIdents(c.GetKeys())
+		markUnique(t, keys, loc)
+		nameKey(t, conName(t, c, keys, "key"), false, keys)
+	case pgquery.ConstrType_CONSTR_FOREIGN:
+		dstS, dstT := pktable(c)
+		src := nodeIdents(c.GetFkAttrs())
+		*tableLevelFKs = append(*tableLevelFKs, FK{
+			Name:      conName(t, c, src, "fkey"),
+			SrcSchema: t.Schema, SrcTable: t.Name,
+			SrcCols:   src,
+			DstSchema: dstS, DstTable: dstT,
+			DstCols: nodeIdents(c.GetPkAttrs()),
+			Created: loc,
+		})
+	case pgquery.ConstrType_CONSTR_CHECK:
+		if re := c.GetRawExpr(); re != nil {
+			t.Constraints = append(t.Constraints, TableConstraint{
+				Name:        c.GetConname(),
+				Type:        "CHECK",
+				Description: extractNodeConstraint(re),
+				Created:     loc,
+			})
+		}
+	}
+}
+
+// conName is a constraint's name, or the one PostgreSQL gives it when it has
+// none: the table and columns with a suffix like pkey, key or fkey.
+func conName(t *Table, c *pgquery.Constraint, cols []string, suffix string) string {
+	if n := c.GetConname(); n != "" {
+		return n
+	}
+	return strings.Join(append(append([]string{t.Name}, cols...), suffix), "_")
+}
+
+// setType stores a type, keeping the original location when a statement
+// redefines one that already exists.
+func setType(customTypes map[string]*CustomType, ct *CustomType, loc *Location) {
+	if old := customTypes[key(ct.Schema, ct.Name)]; old != nil {
+		ct.Created = old.Created
+		ct.Altered = alteredAt(old.Altered, old.Created, loc)
+	}
+	customTypes[key(ct.Schema, ct.Name)] = ct
+}
+
+// addEnumValue inserts v before or after neighbor, or at the end.
+func addEnumValue(values []string, v, neighbor string, after bool) []string {
+	for _, have := range values {
+		if have == v {
+			// ADD VALUE IF NOT EXISTS
+			return values
+		}
+	}
+	for i, have := range values {
+		if have == neighbor {
+			if after {
+				i++
+			}
+			return append(values[:i], append([]string{v}, values[i:]...)...)
+		}
+	}
+	return append(values, v)
+}
+
 func extractViewColumns(query *pgquery.Node) []Column {
 	var cols []Column
 
@@ -419,6 +558,10 @@ func typeName(tn *pgquery.TypeName) string {
 		return ""
 	}
 	parts := nodeIdents(tn.GetNames())
+	if len(parts) > 1 && parts[0] == "pg_catalog" {
+		// built-in types like bigint, named the way sqlc's catalog names them
+		parts = parts[1:]
+	}
 	typ := strings.Join(parts, ".")
 	if l := tn.GetTypmods(); len(l) > 0 {
 		var mods []string
@@ -446,85 +589,3 @@ func nodeIdents(nodes []*pgquery.Node) []string {
 	}
 	return out
 }
-
-// Table manipulation utilities
-func key(s, t string) string {
-	if s == "" {
-		return t
-	}
-	return s + "." + t
-}
-
-func ensureTable(m map[string]*Table, s, t string) *Table {
-	k := key(s, t)
-	if m[k] == nil {
-		m[k] = &Table{Schema: s, Name: t}
-	}
-	return m[k]
-}
-
-func upsertCol(cols []Column, c Column) []Column {
-	for i := range cols {
-		if cols[i].Name == c.Name {
-			if c.Type != "" {
-				cols[i].Type = c.Type
-			}
-			cols[i].PrimaryKey = cols[i].PrimaryKey || c.PrimaryKey
-			cols[i].Unique = cols[i].Unique || c.Unique
-			if c.ForeignKey != nil {
-				cols[i].ForeignKey = c.ForeignKey
-			}
-			return cols
-		}
-	}
-	return append(cols, c)
-}
-
-func removeCol(cols []Column, name string) []Column {
-	result := make([]Column, 0, len(cols))
-	for _, col := range cols {
-		if col.Name != name {
-			result = append(result, col)
-		}
-	}
-	return result
-}
-
-func markPK(t *Table, name string) {
-	for i := range t.Cols {
-		if t.Cols[i].Name == name {
-			t.Cols[i].PrimaryKey = true
-		}
-	}
-}
-
-func markUQ(t *Table, name string) {
-	for i := range t.Cols {
-		if t.Cols[i].Name == name {
-			t.Cols[i].Unique = true
-		}
-	}
-}
-
-func hasAllCols(t *Table, want []string) bool {
-	have := map[string]bool{}
-	for _, c := range t.Cols {
-		have[c.Name] = true
-	}
-	for _, w := range want {
-		if !have[w] {
-			return false
-		}
-	}
-	return true
-}
-
-func tableLabel(schema, name string) string {
-	if name == "" {
-		return ""
-	}
-	if schema == "" || schema == "public" {
-		return name
-	}
-	return schema + "." + name
-}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// mapReader reads migrations from memory.
+func mapReader(files map[string]string) readFunc {
+	return func(path string) ([]byte, error) {
+		return []byte(files[path]), nil
+	}
+}
+
+// locs lists the locations as "file:line".
+func locs(created *Location, altered []*Location) []string {
+	var out []string
+	if created != nil {
+		out = append(out, created.String())
+	}
+	for _, l := range altered {
+		out = append(out, l.String())
+	}
+	return out
+}
+
+func TestProvenance(t *testing.T) {
+	files := map[string]string{
+		"1.sql": `CREATE TABLE users (id int PRIMARY KEY, email text);
+
+-- a comment before the statement
+/* and a block */ CREATE TYPE mood AS ENUM ('sad');
+CREATE VIEW v AS SELECT id FROM users;
+`,
+		"2.sql": `ALTER TABLE users
+	ADD COLUMN m mood,
+	ALTER COLUMN email SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT email_len CHECK (length(email) < 100);
+CREATE OR REPLACE VIEW v AS SELECT id, email FROM users;
+CREATE TABLE posts (id int, user_id int);
+ALTER TABLE posts ADD FOREIGN KEY (user_id) REFERENCES users (id);
+---- create above / drop below ----
+DROP TABLE posts;
+`,
+	}
+	s, err := parseFiles([]string{"1.sql", "2.sql"}, enginePostgreSQL, mapReader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := s.Tables["users"]
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"users", locs(users.Created, users.Altered), []string{"1.sql:1", "2.sql:1", "2.sql:4"}},
+		{"users.id", locs(users.Cols[0].Created, users.Cols[0].Altered), []string{"1.sql:1"}},
+		{"users.email", locs(users.Cols[1].Created, users.Cols[1].Altered), []string{"1.sql:1", "2.sql:1"}},
+		{"users.m", locs(users.Cols[2].Created, users.Cols[2].Altered), []string{"2.sql:1"}},
+		{"email_len", locs(users.Constraints[0].Created, nil), []string{"2.sql:4"}},
+		{"mood", locs(s.Types["mood"].Created, s.Types["mood"].Altered), []string{"1.sql:4"}},
+		{"v", locs(s.Views["v"].Created, s.Views["v"].Altered), []string{"1.sql:5", "2.sql:5"}},
+		{"posts", locs(s.Tables["posts"].Created, s.Tables["posts"].Altered), []string{"2.sql:6", "2.sql:7"}},
+		{"posts FK", locs(s.FKs[0].Created, nil), []string{"2.sql:7"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestProvenanceDDL(t *testing.T) {
+	files := map[string]string{
+		"1.sql": "CREATE TABLE a (x INT);\n\n# created\nCREATE TABLE b (y INT PRIMARY KEY);\n",
+		"2.sql": "ALTER TABLE a ADD COLUMN z INT, MODIFY x BIGINT;\nALTER TABLE a ADD UNIQUE (z);\n",
+	}
+	s, err := parseFiles([]string{"1.sql", "2.sql"}, engineMySQL, mapReader(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := s.Tables["a"]
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"a", locs(a.Created, a.Altered), []string{"1.sql:1", "2.sql:1", "2.sql:2"}},
+		{"a.x", locs(a.Cols[0].Created, a.Cols[0].Altered), []string{"1.sql:1", "2.sql:1"}},
+		{"a.z", locs(a.Cols[1].Created, a.Cols[1].Altered), []string{"2.sql:1", "2.sql:2"}},
+		{"b", locs(s.Tables["b"].Created, s.Tables["b"].Altered), []string{"1.sql:4"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestStmtLine(t *testing.T) {
+	src := []byte("\n  -- note\n/* one\ntwo */\tSELECT 1;\n-- trailing")
+	tests := []struct {
+		offset, want int
+	}{
+		{0, 4},
+		{len(src) - 11, 5},
+		{len(src) + 5, 5},
+	}
+	for _, tt := range tests {
+		if got := stmtLine(src, tt.offset); got != tt.want {
+			t.Errorf("stmtLine(%d) = %d, want %d", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestTypeNames(t *testing.T) {
+	s := parseTestSQL(t, "CREATE TABLE t (a bigint, b varchar(40), c int8[], d audit.kind, e timestamptz);")
+	var got []string
+	for _, c := range s.Tables["t"].Cols {
+		got = append(got, c.Type)
+	}
+	// the same names sqlc's catalog gives them
+	if want := []string{"int8", "varchar(40)", "int8[]", "audit.kind", "timestamptz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build cgo
+
+package main
+
+import pgquery "github.com/pganalyze/pg_query_go/v6"
+
+func pgParse(sql string) (*pgquery.ParseResult, error) {
+	return pgquery.Parse(sql)
+}
+
+// pgDeparse turns a parsed statement back into SQL.
+func pgDeparse(stmt *pgquery.Node) (string, error) {
+	return pgquery.Deparse(&pgquery.ParseResult{Stmts: []*pgquery.RawStmt{{Stmt: stmt}}})
+}
@@ -0,0 +1,21 @@
+//go:build !cgo
+
+package main
+
+import (
+	"errors"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+)
+
+// errNoPostgresParser is returned when the binary was built without cgo, which
+// pg_query needs for the PostgreSQL parser. That includes the wasm build.
+var errNoPostgresParser = errors.New("parsing PostgreSQL needs a cgo build, use the catalog input instead")
+
+func pgParse(string) (*pgquery.ParseResult, error) {
+	return nil, errNoPostgresParser
+}
+
+func pgDeparse(*pgquery.Node) (string, error) {
+	return "", errNoPostgresParser
+}
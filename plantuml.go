@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renderPlantUML writes the schema as a PlantUML entity diagram in IE
+// notation. Key columns sit above the separator and mandatory ones are
+// starred.
+func renderPlantUML(s *Schema) string {
+	var sb strings.Builder
+	sb.WriteString("@startuml\nhide circle\nskinparam linetype ortho\n\n")
+
+	for _, k := range sortedKeys(s.Tables) {
+		t := s.Tables[k]
+		writePlantUMLEntity(&sb, tableLabel(t.Schema, t.Name), "", t.Cols)
+	}
+	for _, k := range sortedKeys(s.Views) {
+		v := s.Views[k]
+		writePlantUMLEntity(&sb, tableLabel(v.Schema, v.Name), " <<view>>", v.Cols)
+	}
+	for _, k := range sortedKeys(s.Types) {
+		ct := s.Types[k]
+		if ct.TypeKind != "enum" {
+			continue
+		}
+		label := tableLabel(ct.Schema, ct.Name)
+		fmt.Fprintf(&sb, "enum %q as %s {\n", label, safeID(label))
+		for _, v := range ct.Values {
+			fmt.Fprintf(&sb, "  %s\n", v)
+		}
+		sb.WriteString("}\n\n")
+	}
+
+	for _, r := range s.relations() {
+		card := "}o"
+		if r.Unique {
+			card = "|o"
+		}
+		fmt.Fprintf(&sb, "%s %s--|| %s : %s\n",
+			safeID(tableLabel(r.From.Schema, r.From.Name)), card,
+			safeID(tableLabel(r.To.Schema, r.To.Name)),
+			strings.Join(r.FromCols, ", "))
+	}
+	sb.WriteString("@enduml\n")
+	return sb.String()
+}
+
+func writePlantUMLEntity(sb *strings.Builder, label, stereotype string, cols []Column) {
+	fmt.Fprintf(sb, "entity %q as %s%s {\n", label, safeID(label), stereotype)
+	var keys, rest []Column
+	for _, c := range cols {
+		if c.PrimaryKey {
+			keys = append(keys, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	line := func(c Column) {
+		mark := "  "
+		if c.PrimaryKey || c.NotNull {
+			mark = "* "
+		}
+		typ := strings.TrimPrefix(c.Type, "pg_catalog.")
+		fmt.Fprintf(sb, "  %s%s", mark, c.Name)
+		if typ != "" && typ != "unknown" {
+			fmt.Fprintf(sb, " : %s", typ)
+		}
+		var tags []string
+		if c.PrimaryKey {
+			tags = append(tags, "<<PK>>")
+		}
+		if c.ForeignKey != nil {
+			tags = append(tags, "<<FK>>")
+		}
+		if c.Unique {
+			tags = append(tags, "<<UK>>")
+		}
+		if len(tags) > 0 {
+			sb.WriteString(" " + strings.Join(tags, " "))
+		}
+		sb.WriteString("\n")
+	}
+	for _, c := range keys {
+		line(c)
+	}
+	if len(keys) > 0 {
+		sb.WriteString("  --\n")
+	}
+	for _, c := range rest {
+		line(c)
+	}
+	sb.WriteString("}\n\n")
+}
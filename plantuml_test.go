@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestRenderPlantUML(t *testing.T) {
+	want := `@startuml
+hide circle
+skinparam linetype ortho
+
+entity "audit" as audit {
+    project_id : int4
+    user_id : int4
+}
+
+entity "profiles" as profiles {
+    user_id : int4 <<FK>> <<UK>>
+    bio : text
+}
+
+entity "project_members" as project_members {
+    project_id : int4 <<FK>>
+    user_id : int4
+    role : text
+}
+
+entity "projects" as projects {
+  * id : int4 <<PK>>
+  --
+  * name : text
+}
+
+entity "users" as users {
+  * id : int4 <<PK>>
+  --
+    email : text <<UK>>
+}
+
+profiles |o--|| users : user_id
+project_members }o--|| projects : project_id
+project_members }o--|| users : user_id
+@enduml
+`
+	if got := renderPlantUML(parseTestSQL(t, membersSQL)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	pb "github.com/sqlc-dev/plugin-sdk-go/plugin"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// queryUsage is what a single sqlc query reads and writes, as table key ->
+// set of column names. A table can be written without any columns, e.g. by a
+// DELETE.
+type queryUsage struct {
+	Name   string
+	Reads  map[string]map[string]bool
+	Writes map[string]map[string]bool
+	Joins  []joinPair
+	Views  map[string]bool // keys of the views it reads
+}
+
+// joinPair is an equality between columns of two tables, from a JOIN
+// condition or WHERE clause.
+type joinPair struct {
+	Left, Right colRef
+}
+
+type colRef struct {
+	Table string // table key
+	Col   string
+}
+
+// tables returns the keys of every table the query touches, sorted.
+func (u *queryUsage) tables() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, m := range []map[string]map[string]bool{u.Reads, u.Writes} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// tableUsage lists the queries touching a table.
+type tableUsage struct {
+	Reads  []string
+	Writes []string
+}
+
+func newQueryUsage(name string) *queryUsage {
+	return &queryUsage{
+		Name:   name,
+		Reads:  map[string]map[string]bool{},
+		Writes: map[string]map[string]bool{},
+		Views:  map[string]bool{},
+	}
+}
+
+func (u *queryUsage) read(table string, cols ...string) {
+	addCols(u.Reads, table, cols)
+}
+
+func (u *queryUsage) write(table string, cols ...string) {
+	addCols(u.Writes, table, cols)
+}
+
+func addCols(m map[string]map[string]bool, table string, cols []string) {
+	if m[table] == nil {
+		m[table] = map[string]bool{}
+	}
+	for _, c := range cols {
+		m[table][c] = true
+	}
+}
+
+// analyzeQueries works out which tables and columns each query touches.
+// PostgreSQL queries are parsed with pg_query. Other engines, and builds
+// without cgo, fall back to the column metadata sqlc attaches to each query,
+// which doesn't cover joins or filters that aren't parameters.
+func analyzeQueries(s *Schema, queries []*pb.Query) []*queryUsage {
+	var out []*queryUsage
+	for _, q := range queries {
+		var u *queryUsage
+		if s.Engine == enginePostgreSQL || s.Engine == "" {
+			if res, err := pgParse(q.GetText()); err == nil {
+				u = pgQueryUsage(s, q.GetName(), res)
+			}
+		}
+		if u == nil {
+			u = metadataUsage(s, q)
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+// usageByTable inverts per-query usage into the queries touching each table.
+func usageByTable(usage []*queryUsage) map[string]*tableUsage {
+	out := map[string]*tableUsage{}
+	get := func(k string) *tableUsage {
+		if out[k] == nil {
+			out[k] = &tableUsage{}
+		}
+		return out[k]
+	}
+	for _, u := range usage {
+		for k := range u.Reads {
+			get(k).Reads = append(get(k).Reads, u.Name)
+		}
+		for k := range u.Writes {
+			get(k).Writes = append(get(k).Writes, u.Name)
+		}
+	}
+	for _, tu := range out {
+		sort.Strings(tu.Reads)
+		sort.Strings(tu.Writes)
+	}
+	return out
+}
+
+// lookupTable resolves a table reference from a query to its key in the
+// model, treating "public" and no schema as the same thing.
+func (s *Schema) lookupTable(schema, name string) (string, *Table) {
+	for _, k := range lookupKeys(schema, name) {
+		if t := s.Tables[k]; t != nil {
+			return k, t
+		}
+	}
+	return "", nil
+}
+
+// lookupView is lookupTable for views.
+func (s *Schema) lookupView(schema, name string) (string, *View) {
+	for _, k := range lookupKeys(schema, name) {
+		if v := s.Views[k]; v != nil {
+			return k, v
+		}
+	}
+	return "", nil
+}
+
+// lookupKeys returns the keys a reference to schema.name can have.
+func lookupKeys(schema, name string) []string {
+	keys := []string{key(schema, name)}
+	switch schema {
+	case "public":
+		keys = append(keys, key("", name))
+	case "":
+		keys = append(keys, key("public", name))
+	}
+	return keys
+}
+
+// viewReads returns the tables and columns the query of the view with key k
+// reads, following the views it reads in turn. Views in seen are skipped, and
+// k is added to it.
+func (s *Schema) viewReads(k string, seen map[string]bool) map[string]map[string]bool {
+	v := s.Views[k]
+	if v == nil || seen[k] {
+		return nil
+	}
+	seen[k] = true
+
+	var u *queryUsage
+	if s.Engine == enginePostgreSQL || s.Engine == "" {
+		if res, err := pgParse(v.Query); err == nil {
+			u = pgQueryUsage(s, k, res)
+		}
+	}
+	if u == nil {
+		u = textUsage(s, k, v.Query)
+	}
+	for vk := range u.Views {
+		for t, cols := range s.viewReads(vk, seen) {
+			addCols(u.Reads, t, sortedKeys(cols))
+		}
+	}
+	return u.Reads
+}
+
+// textUsage is the fallback for a view query pg_query can't parse. It reads
+// the tables and views named after FROM or JOIN, and the columns of those
+// tables the query mentions by name.
+func textUsage(s *Schema, name, query string) *queryUsage {
+	u := newQueryUsage(name)
+	toks, err := tokenizeDDL(query, s.Engine)
+	if err != nil {
+		return u
+	}
+	var tables []string
+	p := &ddlStmt{toks: toks}
+	for !p.done() {
+		if !p.accept("FROM") && !p.accept("JOIN") {
+			p.pos++
+			continue
+		}
+		sch, tn := p.name()
+		if k, t := s.lookupTable(sch, tn); t != nil {
+			u.read(k)
+			tables = append(tables, k)
+		} else if k, v := s.lookupView(sch, tn); v != nil {
+			u.Views[k] = true
+		}
+	}
+	for _, tok := range toks {
+		if tok.kind != tokWord && tok.kind != tokQuoted {
+			continue
+		}
+		for _, k := range tables {
+			for _, c := range s.Tables[k].Cols {
+				if strings.EqualFold(c.Name, tok.text) {
+					u.read(k, c.Name)
+				}
+			}
+		}
+	}
+	return u
+}
+
+// pgScope maps the names a statement can use to refer to the tables in its
+// FROM clause, aliases and bare table names, to their keys in the model.
+// Subqueries get their own scope nested in the one around them.
+type pgScope struct {
+	parent *pgScope
+	names  map[string]string
+}
+
+// open returns the scope of a SELECT, INSERT, UPDATE or DELETE nested in sc,
+// or nil if n isn't one of those.
+func (sc *pgScope) open(s *Schema, n any) *pgScope {
+	var from []*pgquery.Node
+	switch n := n.(type) {
+	case *pgquery.SelectStmt:
+		from = n.GetFromClause()
+	case *pgquery.InsertStmt:
+		from = []*pgquery.Node{{Node: &pgquery.Node_RangeVar{RangeVar: n.GetRelation()}}}
+	case *pgquery.UpdateStmt:
+		from = append([]*pgquery.Node{{Node: &pgquery.Node_RangeVar{RangeVar: n.GetRelation()}}}, n.GetFromClause()...)
+	case *pgquery.DeleteStmt:
+		from = append([]*pgquery.Node{{Node: &pgquery.Node_RangeVar{RangeVar: n.GetRelation()}}}, n.GetUsingClause()...)
+	default:
+		return nil
+	}
+	inner := &pgScope{parent: sc, names: map[string]string{}}
+	var add func(nodes ...*pgquery.Node)
+	add = func(nodes ...*pgquery.Node) {
+		for _, n := range nodes {
+			if j := n.GetJoinExpr(); j != nil {
+				add(j.GetLarg(), j.GetRarg())
+			}
+			rv := n.GetRangeVar()
+			if rv == nil {
+				continue
+			}
+			if k, t := s.lookupTable(rv.GetSchemaname(), rv.GetRelname()); t != nil {
+				inner.names[rv.GetRelname()] = k
+				if a := rv.GetAlias().GetAliasname(); a != "" {
+					inner.names[a] = k
+				}
+			}
+		}
+	}
+	add(from...)
+	return inner
+}
+
+func pgQueryUsage(s *Schema, name string, res *pgquery.ParseResult) *queryUsage {
+	u := newQueryUsage(name)
+	for _, raw := range res.GetStmts() {
+		stmt := raw.GetStmt()
+
+		var target *pgquery.RangeVar
+		switch {
+		case stmt.GetInsertStmt() != nil:
+			ins := stmt.GetInsertStmt()
+			target = ins.GetRelation()
+			if k, t := s.lookupTable(target.GetSchemaname(), target.GetRelname()); t != nil {
+				cols := resTargetNames(ins.GetCols())
+				if len(cols) == 0 {
+					cols = colNames(t.Cols)
+				}
+				u.write(k, cols...)
+			}
+		case stmt.GetUpdateStmt() != nil:
+			upd := stmt.GetUpdateStmt()
+			target = upd.GetRelation()
+			if k, t := s.lookupTable(target.GetSchemaname(), target.GetRelname()); t != nil {
+				u.write(k, resTargetNames(upd.GetTargetList())...)
+			}
+		case stmt.GetDeleteStmt() != nil:
+			target = stmt.GetDeleteStmt().GetRelation()
+			if k, t := s.lookupTable(target.GetSchemaname(), target.GetRelname()); t != nil {
+				u.write(k)
+			}
+		}
+
+		walkPG(stmt.ProtoReflect(), func(m protoreflect.Message) bool {
+			rv, ok := m.Interface().(*pgquery.RangeVar)
+			if !ok || rv == target {
+				return true
+			}
+			// CTEs and tables the model doesn't know about are skipped
+			if k, t := s.lookupTable(rv.GetSchemaname(), rv.GetRelname()); t != nil {
+				u.read(k)
+			} else if k, v := s.lookupView(rv.GetSchemaname(), rv.GetRelname()); v != nil {
+				u.Views[k] = true
+			}
+			return true
+		})
+
+		walkScoped(s, stmt.ProtoReflect(), nil, func(m protoreflect.Message, scope *pgScope) bool {
+			switch n := m.Interface().(type) {
+			case *pgquery.FuncCall:
+				// sqlc.arg(name) and friends aren't column references
+				names := nodeIdents(n.GetFuncname())
+				return len(names) == 0 || names[0] != "sqlc"
+			case *pgquery.ColumnRef:
+				for k, cols := range scope.resolve(s, n) {
+					u.read(k, cols...)
+				}
+			case *pgquery.A_Expr:
+				if jp, ok := scope.joinPair(s, n); ok {
+					u.Joins = append(u.Joins, jp)
+				}
+			case *pgquery.JoinExpr:
+				u.Joins = append(u.Joins, scope.usingPairs(s, n)...)
+			}
+			return true
+		})
+	}
+	return u
+}
+
+// joinPair returns the columns an "a.x = b.y" expression joins, if both sides
+// are columns of different tables.
+func (sc *pgScope) joinPair(s *Schema, e *pgquery.A_Expr) (joinPair, bool) {
+	if e.GetKind() != pgquery.A_Expr_Kind_AEXPR_OP || extractOperatorName(e.GetName()) != "=" {
+		return joinPair{}, false
+	}
+	l, lok := sc.single(s, e.GetLexpr().GetColumnRef())
+	r, rok := sc.single(s, e.GetRexpr().GetColumnRef())
+	if !lok || !rok || l.Table == r.Table {
+		return joinPair{}, false
+	}
+	return joinPair{Left: l, Right: r}, true
+}
+
+// usingPairs returns the columns joined by JOIN ... USING (cols) between two
+// tables.
+func (sc *pgScope) usingPairs(s *Schema, j *pgquery.JoinExpr) []joinPair {
+	l, r := j.GetLarg().GetRangeVar(), j.GetRarg().GetRangeVar()
+	if l == nil || r == nil {
+		return nil
+	}
+	lk, _ := s.lookupTable(l.GetSchemaname(), l.GetRelname())
+	rk, _ := s.lookupTable(r.GetSchemaname(), r.GetRelname())
+	if lk == "" || rk == "" {
+		return nil
+	}
+	var out []joinPair
+	for _, c := range nodeIdents(j.GetUsingClause()) {
+		out = append(out, joinPair{Left: colRef{lk, c}, Right: colRef{rk, c}})
+	}
+	return out
+}
+
+// single resolves a column reference to exactly one table column.
+func (sc *pgScope) single(s *Schema, ref *pgquery.ColumnRef) (colRef, bool) {
+	if ref == nil {
+		return colRef{}, false
+	}
+	cols := sc.resolve(s, ref)
+	if len(cols) != 1 {
+		return colRef{}, false
+	}
+	for k, cs := range cols {
+		if len(cs) == 1 {
+			return colRef{Table: k, Col: cs[0]}, true
+		}
+	}
+	return colRef{}, false
+}
+
+// resolve returns the columns a column reference reads, keyed by table. Names
+// resolve in the innermost scope that has them, the way PostgreSQL resolves
+// them, so an unqualified name is attributed to the tables of that scope
+// with a column by that name and not to the ones of outer queries.
+func (sc *pgScope) resolve(s *Schema, ref *pgquery.ColumnRef) map[string][]string {
+	var qual, col string
+	var star bool
+	fields := ref.GetFields()
+	for i, f := range fields {
+		if f.GetAStar() != nil {
+			star = true
+		} else if i == len(fields)-1 {
+			col = f.GetString_().GetSval()
+		} else {
+			qual = f.GetString_().GetSval()
+		}
+	}
+
+	out := map[string][]string{}
+	for ; sc != nil && len(out) == 0; sc = sc.parent {
+		for name, k := range sc.names {
+			if qual != "" && name != qual {
+				continue
+			}
+			t := s.Tables[k]
+			switch {
+			case star:
+				out[k] = colNames(t.Cols)
+			case findCol(t, col) != nil:
+				out[k] = []string{col}
+			}
+		}
+	}
+	return out
+}
+
+// walkPG calls fn for every message in a pg_query tree, depth first. Returning
+// false from fn skips the message's children.
+func walkPG(m protoreflect.Message, fn func(protoreflect.Message) bool) {
+	walkScoped(nil, m, nil, func(m protoreflect.Message, _ *pgScope) bool { return fn(m) })
+}
+
+// walkScoped is walkPG that also passes fn the scope each message is in, when
+// given the schema to look the scopes' tables up in.
+func walkScoped(s *Schema, m protoreflect.Message, sc *pgScope, fn func(protoreflect.Message, *pgScope) bool) {
+	if !m.IsValid() {
+		return
+	}
+	if s != nil {
+		if inner := sc.open(s, m.Interface()); inner != nil {
+			sc = inner
+		}
+	}
+	if !fn(m, sc) {
+		return
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			l := v.List()
+			for i := 0; i < l.Len(); i++ {
+				walkScoped(s, l.Get(i).Message(), sc, fn)
+			}
+		case fd.Message() != nil && !fd.IsMap():
+			walkScoped(s, v.Message(), sc, fn)
+		}
+		return true
+	})
+}
+
+func resTargetNames(nodes []*pgquery.Node) []string {
+	var out []string
+	for _, n := range nodes {
+		if rt := n.GetResTarget(); rt != nil && rt.GetName() != "" {
+			out = append(out, rt.GetName())
+		}
+	}
+	return out
+}
+
+func colNames(cols []Column) []string {
+	out := make([]string, 0, len(cols))
+	for _, c := range cols {
+		out = append(out, c.Name)
+	}
+	return out
+}
+
+// metadataUsage approximates usage from the columns and parameters sqlc
+// resolved for the query. Parameters of an UPDATE can't be told apart from
+// filter parameters, so they all count as writes.
+func metadataUsage(s *Schema, q *pb.Query) *queryUsage {
+	u := newQueryUsage(q.GetName())
+	verb := queryVerb(q.GetText())
+
+	for _, c := range q.GetColumns() {
+		if k, t := s.lookupTable(c.GetTable().GetSchema(), c.GetTable().GetName()); t != nil {
+			u.read(k, metadataColName(c))
+		} else if k, v := s.lookupView(c.GetTable().GetSchema(), c.GetTable().GetName()); v != nil {
+			u.Views[k] = true
+		}
+	}
+
+	if it := q.GetInsertIntoTable(); it != nil {
+		if k, t := s.lookupTable(it.GetSchema(), it.GetName()); t != nil {
+			u.write(k)
+		}
+	}
+
+	for _, p := range q.GetParams() {
+		c := p.GetColumn()
+		k, t := s.lookupTable(c.GetTable().GetSchema(), c.GetTable().GetName())
+		if t == nil {
+			continue
+		}
+		switch {
+		case verb == "insert" && u.Writes[k] != nil, verb == "update":
+			u.write(k, metadataColName(c))
+		case verb == "delete":
+			u.write(k)
+			u.read(k, metadataColName(c))
+		default:
+			u.read(k, metadataColName(c))
+		}
+	}
+	return u
+}
+
+// queryVerb returns the first keyword of a query, lowercased, skipping the
+// comments and whitespace in front of it.
+func queryVerb(text string) string {
+	for {
+		text = strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(text, "--"), strings.HasPrefix(text, "#"):
+			_, text, _ = strings.Cut(text, "\n")
+		case strings.HasPrefix(text, "/*"):
+			_, text, _ = strings.Cut(text, "*/")
+		default:
+			if f := strings.Fields(text); len(f) > 0 {
+				return strings.ToLower(f[0])
+			}
+			return ""
+		}
+	}
+}
+
+// rewriteNamedParams rewrites @name parameters to sqlc.arg(name), leaving
+// string literals, quoted identifiers and comments alone.
+func rewriteNamedParams(sql string) string {
+	var sb strings.Builder
+	for i := 0; i < len(sql); {
+		rest := sql[i:]
+		n := 1
+		switch {
+		case rest[0] == '\'' || rest[0] == '"':
+			// a doubled quote is an escaped one, which the next loop picks up
+			if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+				n = end + 2
+			} else {
+				n = len(rest)
+			}
+		case strings.HasPrefix(rest, "--"):
+			if end := strings.IndexByte(rest, '\n'); end >= 0 {
+				n = end
+			} else {
+				n = len(rest)
+			}
+		case strings.HasPrefix(rest, "/*"):
+			if end := strings.Index(rest, "*/"); end >= 0 {
+				n = end + 2
+			} else {
+				n = len(rest)
+			}
+		case strings.HasPrefix(rest, "@@"):
+			// the text search operator
+			n = 2
+		case rest[0] == '@':
+			if m := namedParamRe.FindStringSubmatch(rest); m != nil {
+				sb.WriteString("sqlc.arg(" + m[1] + ")")
+				i += len(m[0])
+				continue
+			}
+		}
+		sb.WriteString(rest[:n])
+		i += n
+	}
+	return sb.String()
+}
+
+func metadataColName(c *pb.Column) string {
+	if c.GetOriginalName() != "" {
+		return c.GetOriginalName()
+	}
+	return c.GetName()
+}
+
+var (
+	queryNameRe  = regexp.MustCompile(`^--\s*name:\s*(\S+)\s*(:\S+)?`)
+	namedParamRe = regexp.MustCompile(`^@([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// loadQueries reads sqlc query files for stand-alone runs, splitting them on
+// "-- name: Name :cmd" comments the same way sqlc does. @name parameters are
+// rewritten to sqlc.arg(name) so pg_query can parse them.
+func loadQueries(paths []string) ([]*pb.Query, error) {
+	var out []*pb.Query
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queries %s: %w", path, err)
+		}
+
+		var cur *pb.Query
+		var text strings.Builder
+		flush := func() {
+			if cur != nil {
+				cur.Text = rewriteNamedParams(strings.TrimSpace(text.String()))
+				out = append(out, cur)
+			}
+			text.Reset()
+		}
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := sc.Text()
+			if m := queryNameRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+				flush()
+				cur = &pb.Query{Name: m[1], Cmd: m[2], Filename: path}
+				continue
+			}
+			text.WriteString(line + "\n")
+		}
+		flush()
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read queries %s: %w", path, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	pb "github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+// testSchema builds a schema with the given tables, each given as its
+// column names.
+func testSchema(engine string, tables map[string][]string) *Schema {
+	s := newSchema(engine)
+	for name, cols := range tables {
+		t := ensureTable(s.Tables, "", name)
+		for _, c := range cols {
+			t.Cols = append(t.Cols, Column{Name: c, Type: "text"})
+		}
+	}
+	return s
+}
+
+func blogSchema(engine string) *Schema {
+	return testSchema(engine, map[string][]string{
+		"users":    {"id", "username", "email", "mood"},
+		"posts":    {"id", "user_id", "title", "body"},
+		"comments": {"id", "post_id", "author", "body"},
+	})
+}
+
+// usageLines flattens usage to sorted "r table.col", "w table" style lines.
+func usageLines(u *queryUsage) []string {
+	var out []string
+	for mode, m := range map[string]map[string]map[string]bool{"r": u.Reads, "w": u.Writes} {
+		for k, cols := range m {
+			if len(cols) == 0 {
+				out = append(out, mode+" "+k)
+			}
+			for c := range cols {
+				out = append(out, mode+" "+k+"."+c)
+			}
+		}
+	}
+	for _, j := range u.Joins {
+		out = append(out, "j "+j.Left.Table+"."+j.Left.Col+" = "+j.Right.Table+"."+j.Right.Col)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestPGQueryUsage(t *testing.T) {
+	s := blogSchema(enginePostgreSQL)
+	tests := []struct {
+		name, sql string
+		want      []string
+	}{
+		{
+			name: "select with join",
+			sql:  "select p.title, u.username from posts p join users u on u.id = p.user_id where u.id = $1",
+			want: []string{"j users.id = posts.user_id", "r posts.title", "r posts.user_id", "r users.id", "r users.username"},
+		},
+		{
+			name: "join using",
+			sql:  "select title from posts join comments using (id)",
+			want: []string{"j posts.id = comments.id", "r comments", "r posts.title"},
+		},
+		{
+			name: "star",
+			sql:  "select * from users",
+			want: []string{"r users.email", "r users.id", "r users.mood", "r users.username"},
+		},
+		{
+			name: "insert with columns",
+			sql:  "insert into posts (user_id, title) values ($1, $2) returning id",
+			want: []string{"r posts.id", "w posts.title", "w posts.user_id"},
+		},
+		{
+			name: "insert without columns writes them all",
+			sql:  "insert into users values ($1, $2, $3, $4)",
+			want: []string{"w users.email", "w users.id", "w users.mood", "w users.username"},
+		},
+		{
+			name: "update ignores sqlc.arg",
+			sql:  "update users set mood = sqlc.arg(mood) where id = sqlc.arg(id)",
+			want: []string{"r users.id", "w users.mood"},
+		},
+		{
+			name: "delete",
+			sql:  "delete from posts where id = $1",
+			want: []string{"r posts.id", "w posts"},
+		},
+		{
+			name: "subqueries resolve names in their own scope",
+			sql:  "select title from posts where user_id in (select id from users where mood = $1)",
+			want: []string{"r posts.title", "r posts.user_id", "r users.id", "r users.mood"},
+		},
+		{
+			name: "correlated subqueries fall back to the outer scope",
+			sql:  "select email from users where exists (select 1 from posts where id = $1 and title like username)",
+			want: []string{"r posts.id", "r posts.title", "r users.email", "r users.username"},
+		},
+		{
+			name: "unknown tables and ctes are skipped",
+			sql:  "with recent as (select id from posts) select id from recent join audit on true",
+			want: []string{"r posts.id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := pgParse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := usageLines(pgQueryUsage(s, "Q", res))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteNamedParams(t *testing.T) {
+	tests := []struct{ sql, want string }{
+		{"select * from users where id = @id", "select * from users where id = sqlc.arg(id)"},
+		{"update users set email = @email where email = 'a@b.com'", "update users set email = sqlc.arg(email) where email = 'a@b.com'"},
+		{"select 'it''s @x', \"@y\" from t -- @z\nwhere a = @a /* @b */", "select 'it''s @x', \"@y\" from t -- @z\nwhere a = sqlc.arg(a) /* @b */"},
+		{"select * from docs where tsv @@ to_tsquery(@q)", "select * from docs where tsv @@ to_tsquery(sqlc.arg(q))"},
+	}
+	for _, tt := range tests {
+		if got := rewriteNamedParams(tt.sql); got != tt.want {
+			t.Errorf("rewriteNamedParams(%q)\ngot  %q\nwant %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func usersCol(name string) *pb.Column {
+	return &pb.Column{Name: name, Table: &pb.Identifier{Name: "users"}}
+}
+
+func TestMetadataUsage(t *testing.T) {
+	s := blogSchema(engineMySQL)
+	tests := []struct {
+		name string
+		q    *pb.Query
+		want []string
+	}{
+		{
+			name: "select",
+			q: &pb.Query{
+				Text:    "SELECT id, email FROM users WHERE username = ?",
+				Columns: []*pb.Column{usersCol("id"), usersCol("email")},
+				Params:  []*pb.Parameter{{Number: 1, Column: usersCol("username")}},
+			},
+			want: []string{"r users.email", "r users.id", "r users.username"},
+		},
+		{
+			name: "update after a comment",
+			q: &pb.Query{
+				Text:   "-- keep moods fresh\nUPDATE users SET mood = ? WHERE id = ?",
+				Params: []*pb.Parameter{{Number: 1, Column: usersCol("mood")}, {Number: 2, Column: usersCol("id")}},
+			},
+			want: []string{"w users.id", "w users.mood"},
+		},
+		{
+			name: "delete on its own line",
+			q: &pb.Query{
+				Text:   "/* gone */ DELETE\nFROM users WHERE id = ?",
+				Params: []*pb.Parameter{{Number: 1, Column: usersCol("id")}},
+			},
+			want: []string{"r users.id", "w users"},
+		},
+		{
+			name: "insert",
+			q: &pb.Query{
+				Text:            "INSERT INTO users (username, email) VALUES (?, ?)",
+				InsertIntoTable: &pb.Identifier{Name: "users"},
+				Params:          []*pb.Parameter{{Number: 1, Column: usersCol("username")}, {Number: 2, Column: usersCol("email")}},
+			},
+			want: []string{"w users.email", "w users.username"},
+		},
+		{
+			name: "original names win over aliases",
+			q: &pb.Query{
+				Text:    "SELECT email AS contact FROM users",
+				Columns: []*pb.Column{{Name: "contact", OriginalName: "email", Table: &pb.Identifier{Name: "users"}}},
+			},
+			want: []string{"r users.email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := usageLines(metadataUsage(s, tt.q))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryVerb(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"SELECT 1", "select"},
+		{"  update\tusers SET a = 1", "update"},
+		{"DELETE\nFROM users", "delete"},
+		{"-- name: X :exec\n-- another\nINSERT INTO t VALUES (1)", "insert"},
+		{"# mysql comment\nreplace into t values (1)", "replace"},
+		{"/* a\nb */ /**/ Delete from t", "delete"},
+		{"-- only a comment", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := queryVerb(tt.text); got != tt.want {
+			t.Errorf("queryVerb(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeQueries(t *testing.T) {
+	queries := []*pb.Query{
+		{Name: "Parsed", Text: "select username from users where id = $1"},
+		{
+			// pg_query can't parse MySQL's placeholders, so this one falls
+			// back to sqlc's metadata
+			Name:    "Fallback",
+			Text:    "SELECT email FROM users WHERE id = ?",
+			Columns: []*pb.Column{usersCol("email")},
+		},
+	}
+	want := map[string][]string{
+		"Parsed":   {"r users.id", "r users.username"},
+		"Fallback": {"r users.email"},
+	}
+
+	usage := analyzeQueries(blogSchema(enginePostgreSQL), queries)
+	if len(usage) != len(queries) {
+		t.Fatalf("got %d usages for %d queries", len(usage), len(queries))
+	}
+	for _, u := range usage {
+		if got := usageLines(u); !reflect.DeepEqual(got, want[u.Name]) {
+			t.Errorf("%s: got %q, want %q", u.Name, got, want[u.Name])
+		}
+	}
+
+	// other engines always use the metadata
+	usage = analyzeQueries(blogSchema(engineMySQL), queries[:1])
+	if got := usageLines(usage[0]); len(got) != 0 {
+		t.Errorf("mysql: got %q, want no usage without metadata", got)
+	}
+
+	byTable := usageByTable(analyzeQueries(blogSchema(enginePostgreSQL), queries))
+	if got := byTable["users"].Reads; !reflect.DeepEqual(got, []string{"Fallback", "Parsed"}) {
+		t.Errorf("users read by %q", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import "sort"
+
+// relation is a foreign key between two tables in the model, resolved the
+// same way the d2 renderer draws its edges.
+type relation struct {
+	From, To         *Table
+	FromCols, ToCols []string
+	// Unique is set when the referencing columns are unique themselves, making
+	// it a one-to-one relation.
+	Unique bool
+}
+
+// relations returns every foreign key whose both ends are in the model, in a
+// stable order.
+func (s *Schema) relations() []relation {
+	var out []relation
+	ks := sortedKeys(s.Tables)
+	for _, k := range ks {
+		t := s.Tables[k]
+		for _, c := range t.Cols {
+			if c.ForeignKey == nil {
+				continue
+			}
+			_, dst := s.lookupTable(c.ForeignKey.DstSchema, c.ForeignKey.DstTable)
+			if dst == nil {
+				continue
+			}
+			out = append(out, relation{
+				From: t, To: dst,
+				FromCols: []string{c.Name},
+				ToCols:   refCols(dst, c.ForeignKey.DstCols),
+				Unique:   uniqueCol(t, c),
+			})
+		}
+	}
+
+	for _, fk := range s.FKs {
+		_, dst := s.lookupTable(fk.DstSchema, fk.DstTable)
+		t := s.fkOwner(fk)
+		if dst == nil || t == nil {
+			continue
+		}
+		unique := len(fk.SrcCols) == 1
+		for _, n := range fk.SrcCols {
+			if c := findCol(t, n); c == nil || !uniqueCol(t, *c) {
+				unique = false
+			}
+		}
+		out = append(out, relation{
+			From: t, To: dst,
+			FromCols: fk.SrcCols,
+			ToCols:   refCols(dst, fk.DstCols),
+			Unique:   unique,
+		})
+	}
+	return out
+}
+
+// fkOwner returns the table that declared a table-level FK, nil if it's
+// gone.
+func (s *Schema) fkOwner(fk FK) *Table {
+	return s.Tables[key(fk.SrcSchema, fk.SrcTable)]
+}
+
+// refCols returns the referenced columns, which default to the primary key
+// when the FK doesn't list them.
+func refCols(t *Table, cols []string) []string {
+	if len(cols) > 0 {
+		return cols
+	}
+	for _, c := range t.Cols {
+		if c.PrimaryKey {
+			cols = append(cols, c.Name)
+		}
+	}
+	return cols
+}
+
+// uniqueCol reports whether c on its own is unique, which a column that's
+// part of a composite primary key or unique constraint isn't.
+func uniqueCol(t *Table, c Column) bool {
+	if c.Unique {
+		return true
+	}
+	if !c.PrimaryKey {
+		return false
+	}
+	for _, o := range t.Cols {
+		if o.PrimaryKey && o.Name != c.Name {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
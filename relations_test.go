@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRelations(t *testing.T) {
+	s := parseTestSQL(t, membersSQL)
+	var got []string
+	for _, r := range s.relations() {
+		got = append(got, fmt.Sprintf("%s(%s) -> %s(%s) unique=%v",
+			r.From.Name, strings.Join(r.FromCols, ","), r.To.Name, strings.Join(r.ToCols, ","), r.Unique))
+	}
+	want := []string{
+		"profiles(user_id) -> users(id) unique=true",
+		// unique together with user_id, not on its own
+		"project_members(project_id) -> projects(id) unique=false",
+		// declared on project_members, though audit has a user_id too
+		"project_members(user_id) -> users(id) unique=false",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestUniqueCol(t *testing.T) {
+	s := parseTestSQL(t, `
+CREATE TABLE single (id int PRIMARY KEY, code text UNIQUE, other text);
+CREATE TABLE composite (a int, b int, c int, PRIMARY KEY (a, b), UNIQUE (b, c));
+`)
+	tests := []struct {
+		table, col string
+		want       bool
+	}{
+		{"single", "id", true},
+		{"single", "code", true},
+		{"single", "other", false},
+		{"composite", "a", false},
+		{"composite", "b", false},
+		{"composite", "c", false},
+	}
+	for _, tt := range tests {
+		tbl := s.Tables[tt.table]
+		if got := uniqueCol(tbl, *findCol(tbl, tt.col)); got != tt.want {
+			t.Errorf("uniqueCol(%s.%s) = %v, want %v", tt.table, tt.col, got, tt.want)
+		}
+	}
+	if got, want := s.Tables["composite"].Uniques, [][]string{{"b", "c"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniques %q, want %q", got, want)
+	}
+}
+
+func TestFKOwner(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+`
+DROP TABLE project_members;
+`)
+	// the FK went with its table rather than moving to audit
+	for _, fk := range s.FKs {
+		if o := s.fkOwner(fk); o != nil {
+			t.Errorf("FK %+v is owned by %s", fk, o.Name)
+		}
+	}
+	if rs := s.relations(); len(rs) != 1 || rs[0].From.Name != "profiles" {
+		t.Errorf("relations %+v, want only profiles -> users", rs)
+	}
+}
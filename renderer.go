@@ -1,51 +1,117 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"sort"
 	"strings"
 
-	"oss.terrastruct.com/d2/d2graph"
-	"oss.terrastruct.com/d2/d2lib"
-	"oss.terrastruct.com/d2/d2oracle"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2parser"
 )
 
-// renderD2 creates a D2 graph representation of the database schema
-func renderD2(tables map[string]*Table, tlfk []FK, views map[string]*View, customTypes map[string]*CustomType) (*d2graph.Graph, error) {
+// renderOptions are the optional annotations drawn on top of the schema.
+type renderOptions struct {
+	detail string
+	// usage is keyed like the tables map, tables without an entry aren't
+	// annotated
+	usage map[string]*tableUsage
+	// unused tables are faded and unused columns marked, nil to skip
+	unused *unusedReport
+	// joins have their columns marked and the FK edges they follow
+	// emphasised, joins no FK backs get a dashed edge of their own
+	joins []joinPair
+	// tooltips summarise every table, view and type
+	tooltips bool
+	// link returns the URL an object links to, nil or "" for none
+	link func(kind, label string, loc *Location) string
+	// diff colours added, removed and changed objects and marks their
+	// columns, nil to skip
+	diff *schemaDiff
+}
+
+// renderD2Text writes the schema as D2 source. The native build compiles it
+// to lay the diagram out, the wasm build, which can't, writes it as is.
+func renderD2Text(tables map[string]*Table, tlfk []FK, views map[string]*View, customTypes map[string]*CustomType, ro renderOptions) (string, error) {
+	detail := ro.detail
 	ks := make([]string, 0, len(tables))
 	for k := range tables {
 		ks = append(ks, k)
 	}
 	sort.Strings(ks)
 
-	// initialise with classes section
-	_, g, _ := d2lib.Compile(context.Background(), classesSection(), nil, nil)
+	root := &d2Map{}
+	// keys of the collections views and types are grouped in, by name
+	collections := map[string]string{}
 
-	var err error
+	// labels of the tables being drawn, edges to anything else are skipped
+	// so filtered tables don't reappear as empty shapes
+	drawn := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		drawn[tableLabel(t.Schema, t.Name)] = true
+	}
+
+	// join columns and edges, by table label
+	joinCols := map[string]map[string]bool{}
+	joinEdges := map[string]bool{}
+	for _, jp := range ro.joins {
+		l, r := tables[jp.Left.Table], tables[jp.Right.Table]
+		if l == nil || r == nil {
+			continue
+		}
+		ls := tableLabel(l.Schema, l.Name) + "." + jp.Left.Col
+		rs := tableLabel(r.Schema, r.Name) + "." + jp.Right.Col
+		addCols(joinCols, tableLabel(l.Schema, l.Name), []string{jp.Left.Col})
+		addCols(joinCols, tableLabel(r.Schema, r.Name), []string{jp.Right.Col})
+		joinEdges[ls+" -> "+rs] = true
+		joinEdges[rs+" -> "+ls] = true
+	}
+	followed := map[string]bool{}
+	fkEdge := func(left, col, right, dstCol, change string) {
+		src, dst := left+"."+col, right
+		if dstCol != "" {
+			dst += "." + dstCol
+		}
+		edge := src + " -> " + dst
+		e := root.edge(d2Key(left)+"."+d2Key(col), "->", d2Key(dst), "")
+		setChangeStyle(e, change)
+		if !joinEdges[edge] {
+			return
+		}
+		followed[edge] = true
+		followed[dst+" -> "+src] = true
+		setJoinStyle(e)
+	}
 
 	for _, k := range ks {
 		t := tables[k]
-		title := t.Name
-		if t.Schema != "" && t.Schema != "public" {
-			title = t.Schema + "." + t.Name
+		title := tableLabel(t.Schema, t.Name)
+		tm := root.get(d2Key(title))
+		tm.set("class", "table")
+		var tooltip []string
+		if ro.tooltips {
+			tooltip = tableSummary(t)
 		}
-		if g == nil {
-			panic("g was nil")
+		if tu := ro.usage[k]; tu != nil {
+			tooltip = append(tooltip, annotateUsage(tm, title, tu)...)
 		}
-		g, _, _ = d2oracle.Create(g, nil, title)
-		err = setTableClass(g, title)
-		if err != nil {
-			return nil, err
+		ro.decorate(tm, title, "table", t.Created, tooltip)
+		setChangeStyle(tm, ro.diff.table(k))
+		var unusedCols map[string]bool
+		if ro.unused != nil {
+			if ro.unused.table(title) {
+				setUnusedStyle(tm)
+			}
+			unusedCols = ro.unused.columns(title)
 		}
-		for _, c := range t.Cols {
+		for _, c := range visibleCols(t, detail) {
 			typ := c.Type
 			typ, _ = strings.CutPrefix(typ, "pg_catalog.")
-
-			g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s", title, c.Name), nil, &typ)
-			if err != nil {
-				return nil, fmt.Errorf("failed to set column type on %s.%s: %w", title, c.Name, err)
+			if old := ro.diff.oldType(k, c.Name); old != "" {
+				old, _ = strings.CutPrefix(old, "pg_catalog.")
+				typ = fmt.Sprintf("%s (was %s)", typ, old)
 			}
+			tm.set(d2Key(c.Name), typ)
+
 			var cons []string
 			if c.PrimaryKey {
 				cons = append(cons, "PK")
@@ -56,65 +122,98 @@ func renderD2(tables map[string]*Table, tlfk []FK, views map[string]*View, custo
 			if c.ForeignKey != nil {
 				cons = append(cons, "FK")
 			}
+			if unusedCols[c.Name] {
+				cons = append(cons, "unused")
+			}
+			if joinCols[title][c.Name] {
+				cons = append(cons, "join")
+			}
+			switch ro.diff.column(k, c.Name) {
+			case changeAdded:
+				cons = append(cons, "new")
+			case changeRemoved:
+				cons = append(cons, "removed")
+			case changeChanged:
+				cons = append(cons, "changed")
+			}
 			if len(cons) > 0 {
-				g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s.constraint", title, c.Name), nil, strPtr(strings.Join(cons, " ")))
-				if err != nil {
-					return nil, fmt.Errorf("failed to set column constraints on %s.%s: %w", title, c.Name, err)
-				}
+				tm.get(d2Key(c.Name)).set("constraint", strings.Join(cons, " "))
 			}
 		}
 
+		if detail != detailFull {
+			continue
+		}
+
 		// Add table-level constraints
 		for _, constraint := range t.Constraints {
 			constraintName := constraint.Name
 			if constraintName == "" {
 				constraintName = fmt.Sprintf("check_%d", len(t.Constraints))
 			}
-			g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s", title, constraintName), nil, strPtr(constraint.Description))
-			if err != nil {
-				return nil, fmt.Errorf("failed to set table constraint on %s.%s: %w", title, constraintName, err)
-			}
+			tm.set(d2Key(constraintName), constraint.Description)
 		}
 	}
 
 	// column-level FK edges
-	for _, t := range tables {
+	for _, k := range ks {
+		t := tables[k]
 		left := tableLabel(t.Schema, t.Name)
 		for _, c := range t.Cols {
 			if c.ForeignKey == nil {
 				continue
 			}
 			right := tableLabel(c.ForeignKey.DstSchema, c.ForeignKey.DstTable)
+			if !drawn[right] {
+				continue
+			}
 			dstCol := ""
-			if len(c.ForeignKey.DstCols) > 0 {
+			if detail != detailTables && len(c.ForeignKey.DstCols) > 0 {
 				dstCol = c.ForeignKey.DstCols[0]
 			}
-			if dstCol != "" {
-				g, _, _ = d2oracle.Create(g, nil, ""+left+"."+c.Name+" -> "+right+"."+dstCol)
-			} else {
-				g, _, _ = d2oracle.Create(g, nil, ""+left+"."+c.Name+" -> "+right)
-			}
+			fkEdge(left, c.Name, right, dstCol, ro.diff.columnFK(key(t.Schema, t.Name), c.Name))
 		}
 	}
 
 	// table-level FK edges (pair cols if possible; else table edge)
 	for _, fk := range tlfk {
 		right := tableLabel(fk.DstSchema, fk.DstTable)
-		for _, t := range tables {
-			if hasAllCols(t, fk.SrcCols) {
-				left := tableLabel(t.Schema, t.Name)
-				if len(fk.SrcCols) == len(fk.DstCols) && len(fk.SrcCols) > 0 {
-					for i := range fk.SrcCols {
-						g, _, _ = d2oracle.Create(g, nil, ""+left+"."+fk.SrcCols[i]+" -> "+right+"."+fk.DstCols[i])
-					}
-				} else {
-					g, _, _ = d2oracle.Create(g, nil, ""+left+" -> "+right)
-				}
-				break
+		if !drawn[right] {
+			continue
+		}
+		t := tables[key(fk.SrcSchema, fk.SrcTable)]
+		if t == nil {
+			continue
+		}
+		left := tableLabel(t.Schema, t.Name)
+		change := ro.diff.fk(key(t.Schema, t.Name), fk)
+		if detail != detailTables && len(fk.SrcCols) == len(fk.DstCols) && len(fk.SrcCols) > 0 {
+			for i := range fk.SrcCols {
+				fkEdge(left, fk.SrcCols[i], right, fk.DstCols[i], change)
 			}
+		} else {
+			setChangeStyle(root.edge(d2Key(left), "->", d2Key(right), ""), change)
 		}
 	}
 
+	// joins that don't follow any FK
+	for _, jp := range ro.joins {
+		l, r := tables[jp.Left.Table], tables[jp.Right.Table]
+		if l == nil || r == nil {
+			continue
+		}
+		lt, rt := tableLabel(l.Schema, l.Name), tableLabel(r.Schema, r.Name)
+		ls, rs := lt+"."+jp.Left.Col, rt+"."+jp.Right.Col
+		if followed[ls+" -> "+rs] {
+			continue
+		}
+		followed[ls+" -> "+rs] = true
+		followed[rs+" -> "+ls] = true
+		e := root.edge(d2Key(lt)+"."+d2Key(jp.Left.Col), "--", d2Key(rt)+"."+d2Key(jp.Right.Col), "join")
+		setJoinStyle(e)
+		e.set("style.stroke-dash", "3")
+	}
+
 	// views
 	vks := make([]string, 0, len(views))
 	for k := range views {
@@ -122,29 +221,17 @@ func renderD2(tables map[string]*Table, tlfk []FK, views map[string]*View, custo
 	}
 	sort.Strings(vks)
 
-	err = createViewCollection(g)
-	if err != nil {
-		return nil, err
-	}
-
 	for _, k := range vks {
 		v := views[k]
-		schema := v.Schema
-		if schema != "" && schema != "public" {
-			schema = v.Schema + "." + v.Name
-		}
-		var title string
-		if schema != "" {
-			title = fmt.Sprintf("%s.%s.%s", viewsKey, schema, v.Name)
-		} else {
-			title = fmt.Sprintf("%s.%s", viewsKey, v.Name)
-		}
-		g, _, _ = d2oracle.Create(g, nil, title)
-		var err error
-		err = setViewClass(g, title)
-		if err != nil {
-			return nil, err
+		title := tableLabel(v.Schema, v.Name)
+		vm := collection(root, collections, "views", "views").get(d2Key(title))
+		vm.set("class", "view")
+		var tooltip []string
+		if ro.tooltips {
+			tooltip = viewSummary(v)
 		}
+		ro.decorate(vm, title, "view", v.Created, tooltip)
+		setChangeStyle(vm, ro.diff.view(k))
 
 		// Add view columns
 		for _, c := range v.Cols {
@@ -152,10 +239,7 @@ func renderD2(tables map[string]*Table, tlfk []FK, views map[string]*View, custo
 			if typ == "unknown" {
 				typ = "" // Don't show unknown types
 			}
-			g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s", title, c.Name), nil, &typ)
-			if err != nil {
-				return nil, fmt.Errorf("failed to set view column on %s.%s: %w", title, c.Name, err)
-			}
+			vm.set(d2Key(c.Name), typ)
 		}
 	}
 
@@ -168,172 +252,149 @@ func renderD2(tables map[string]*Table, tlfk []FK, views map[string]*View, custo
 
 	for _, k := range ctks {
 		ct := customTypes[k]
-		title := ct.Name
-		if ct.Schema != "" && ct.Schema != "public" {
-			title = ct.Schema + "." + ct.Name
-		}
-		var err error
+		title := tableLabel(ct.Schema, ct.Name)
+		var tm *d2Map
 
 		// Set different styles for different type kinds
 		switch ct.TypeKind {
 		case "enum":
-			err = createEnumCollection(g)
-			if err != nil {
-				return nil, err
-			}
-			g, title, err = d2oracle.Create(g, nil, fmt.Sprintf("%s.%s", enumsKey, title))
-			if err != nil {
-				return nil, fmt.Errorf("failed to create enum %s: %w", title, err)
-			}
+			tm = collection(root, collections, "enums", "enums").get(d2Key(title))
+			tm.set("class", "enum")
 			// Add enum values as "columns"
 			for _, value := range ct.Values {
-				g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s", title, value), nil, strPtr(""))
-				if err != nil {
-					return nil, fmt.Errorf("failed to set enum value on %s.%s: %w", title, value, err)
-				}
-			}
-			err = setEnumClass(g, title)
-			if err != nil {
-				return nil, err
+				tm.set(d2Key(value), "")
 			}
 
 		case "domain":
-			err = createDomainCollection(g)
-			if err != nil {
-				return nil, err
-			}
-			title = fmt.Sprintf("%s.%s", domainsKey, title)
-
-			g, title, err = d2oracle.Create(g, nil, title)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create domain %s: %w", title, err)
-			}
-
+			tm = collection(root, collections, "domains", "domains").get(d2Key(title))
+			tm.set("class", "domain")
 			// Show base type and constraints
-			baseTypeLabel := "base_type"
-			g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s", title, baseTypeLabel), nil, &ct.BaseType)
-			if err != nil {
-				return nil, fmt.Errorf("failed to set base type on %s: %w", title, err)
-			}
+			tm.set("base_type", ct.BaseType)
 			if ct.Check != "" {
-				g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.constraints", title), nil, strPtr(ct.Check))
-				if err != nil {
-					return nil, fmt.Errorf("failed to set constraints on %s: %w", title, err)
-				}
-			}
-			err = setDomainClass(g, title)
-			if err != nil {
-				return nil, err
+				tm.set("constraints", ct.Check)
 			}
 
 		case "composite":
-			err = createCompositeCollection(g)
-			if err != nil {
-				return nil, err
-			}
-			g, title, err = d2oracle.Create(g, nil, fmt.Sprintf("%s.%s", compositesKey, title))
-			if err != nil {
-				return nil, fmt.Errorf("failed to create composite type %s: %w", title, err)
-			}
+			tm = collection(root, collections, "composites", "composite_collection").get(d2Key(title))
+			tm.set("class", "composite")
 			// Add composite type columns
 			for _, col := range ct.Cols {
-				g, err = d2oracle.Set(g, nil, fmt.Sprintf("%s.%s", title, col.Name), nil, &col.Type)
-				if err != nil {
-					return nil, fmt.Errorf("failed to set composite column on %s.%s: %w", title, col.Name, err)
-				}
-			}
-			err = setCompositeClass(g, title)
-			if err != nil {
-				return nil, err
+				tm.set(d2Key(col.Name), col.Type)
 			}
+
+		default:
+			continue
 		}
-	}
 
-	// // Add relationships from tables/views to custom types they use
-	// g, err = addCustomTypeRelationships(g, tables, views, customTypes)
-	// if err != nil {
-	// 	return nil, fmt.Errorf("failed to add custom type relationships: %w", err)
-	// }
+		var tooltip []string
+		if ro.tooltips {
+			tooltip = typeSummary(ct)
+		}
+		ro.decorate(tm, title, ct.TypeKind, ct.Created, tooltip)
+		setChangeStyle(tm, ro.diff.customType(k))
+	}
 
-	return g, nil
+	src := strings.TrimPrefix(classesSection(), "\n") + "\n" + root.String()
+	ast, err := d2parser.Parse("", strings.NewReader(src), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse d2: %w", err)
+	}
+	return d2format.Format(ast), nil
 }
 
-func addCustomTypeRelationships(g *d2graph.Graph, tables map[string]*Table, views map[string]*View, customTypes map[string]*CustomType) (*d2graph.Graph, error) {
-	// Track which custom types are used
-	usedTypes := make(map[string]bool)
+// annotateUsage adds read/write counts to a table's label and returns the
+// tooltip lines listing the queries.
+func annotateUsage(m *d2Map, title string, tu *tableUsage) []string {
+	var counts, tooltip []string
+	if len(tu.Reads) > 0 {
+		counts = append(counts, plural(len(tu.Reads), "read"))
+		tooltip = append(tooltip, "Read by: "+strings.Join(tu.Reads, ", "))
+	}
+	if len(tu.Writes) > 0 {
+		counts = append(counts, plural(len(tu.Writes), "write"))
+		tooltip = append(tooltip, "Written by: "+strings.Join(tu.Writes, ", "))
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	m.set("label", fmt.Sprintf("%s (%s)", title, strings.Join(counts, ", ")))
+	return tooltip
+}
 
-	// Check table columns for custom type usage
-	for _, table := range tables {
-		tableTitle := table.Name
-		if table.Schema != "" && table.Schema != "public" {
-			tableTitle = table.Schema + "." + table.Name
-		}
+// decorate sets the tooltip and link of the object drawn for label.
+func (ro renderOptions) decorate(m *d2Map, label, kind string, loc *Location, tooltip []string) {
+	if len(tooltip) > 0 {
+		m.set("tooltip", strings.Join(tooltip, "\n"))
+	}
+	if ro.link == nil {
+		return
+	}
+	if link := ro.link(kind, label, loc); link != "" {
+		m.set("link", link)
+	}
+}
 
-		for _, col := range table.Cols {
-			// Check if the column type matches any custom type
-			for ctKey, ct := range customTypes {
-				if col.Type == ct.Name || col.Type == ctKey {
-					usedTypes[ctKey] = true
-					// Create relationship from table column to custom type
-					ctTitle := ct.Name
-					if ct.Schema != "" && ct.Schema != "public" {
-						ctTitle = ct.Schema + "." + ct.Name
-					}
-					t := fmt.Sprintf("%ss.%s", ct.TypeKind, ctTitle)
-					g, _, _ = d2oracle.Create(g, nil, fmt.Sprintf("%s.%s -> %s", tableTitle, col.Name, t))
-				}
-			}
-		}
+// provenance says where an object was defined and every place that altered it.
+func provenance(created *Location, altered []*Location) []string {
+	var lines []string
+	if created != nil {
+		lines = append(lines, "Defined in "+created.String())
 	}
+	for _, l := range altered {
+		lines = append(lines, "Altered in "+l.String())
+	}
+	return lines
+}
 
-	// Check view columns for custom type usage
-	for _, view := range views {
-		viewTitle := view.Name
-		if view.Schema != "" && view.Schema != "public" {
-			viewTitle = view.Schema + "." + view.Name
+// tableSummary is a table's tooltip: its keys, what it references and where
+// it's defined.
+func tableSummary(t *Table) []string {
+	var pks, refs []string
+	for _, c := range t.Cols {
+		if c.PrimaryKey {
+			pks = append(pks, c.Name)
 		}
-
-		for _, col := range view.Cols {
-			// Check if the column type matches any custom type
-			for ctKey, ct := range customTypes {
-				if col.Type == ct.Name || col.Type == ctKey {
-					usedTypes[ctKey] = true
-					// Create relationship from view column to custom type
-					ctTitle := ct.Name
-					if ct.Schema != "" && ct.Schema != "public" {
-						ctTitle = ct.Schema + "." + ct.Name
-					}
-					g, _, _ = d2oracle.Create(g, nil, fmt.Sprintf("%s.%s -> %s", viewTitle, col.Name, ctTitle))
-				}
-			}
+		if c.ForeignKey != nil {
+			refs = append(refs, tableLabel(c.ForeignKey.DstSchema, c.ForeignKey.DstTable))
 		}
 	}
+	lines := []string{plural(len(t.Cols), "column")}
+	if len(pks) > 0 {
+		lines[0] += ", primary key " + strings.Join(pks, ", ")
+	}
+	if len(refs) > 0 {
+		lines = append(lines, "References "+strings.Join(refs, ", "))
+	}
+	if len(t.Constraints) > 0 {
+		lines = append(lines, plural(len(t.Constraints), "check constraint"))
+	}
+	lines = append(lines, provenance(t.Created, t.Altered)...)
+	for _, c := range t.Cols {
+		if c.Created != nil && (t.Created == nil || *c.Created != *t.Created) {
+			lines = append(lines, fmt.Sprintf("Column %s added in %s", c.Name, c.Created))
+		}
+	}
+	return lines
+}
 
-	// Also check for composite types used within other composite types
-	for _, ct := range customTypes {
-		if ct.TypeKind == "composite" {
-			ctTitle := ct.Name
-			if ct.Schema != "" && ct.Schema != "public" {
-				ctTitle = ct.Schema + "." + ct.Name
-			}
+func viewSummary(v *View) []string {
+	return append([]string{"View, " + plural(len(v.Cols), "column")}, provenance(v.Created, v.Altered)...)
+}
 
-			for _, col := range ct.Cols {
-				for otherCtKey, otherCt := range customTypes {
-					if col.Type == otherCt.Name || col.Type == otherCtKey {
-						usedTypes[otherCtKey] = true
-						// Create relationship from composite type field to other custom type
-						otherCtTitle := otherCt.Name
-						if otherCt.Schema != "" && otherCt.Schema != "public" {
-							otherCtTitle = otherCt.Schema + "." + otherCt.Name
-						}
-						g, _, _ = d2oracle.Create(g, nil, fmt.Sprintf("%s.%s -> %s", ctTitle, col.Name, otherCtTitle))
-					}
-				}
-			}
+func typeSummary(ct *CustomType) []string {
+	var line string
+	switch ct.TypeKind {
+	case "enum":
+		line = "Enum: " + strings.Join(ct.Values, ", ")
+	case "domain":
+		line = "Domain over " + ct.BaseType
+		if ct.Check != "" {
+			line += " CHECK " + ct.Check
 		}
+	default:
+		line = "Composite type, " + plural(len(ct.Cols), "field")
 	}
-
-	return g, nil
+	return append([]string{line}, provenance(ct.Created, ct.Altered)...)
 }
 
 func strPtr(s string) *string {
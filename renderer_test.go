@@ -0,0 +1,137 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"oss.terrastruct.com/d2/d2format"
+)
+
+func TestRenderD2Decorations(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+`
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+ALTER TABLE users ADD COLUMN m mood;
+CREATE VIEW v AS SELECT id FROM users;
+`)
+	ro := renderOptions{
+		detail:   detailFull,
+		tooltips: true,
+		link:     Options{Link: "{page}#L{line}"}.expandLink,
+	}
+	g, err := renderD2(s.Tables, s.FKs, s.Views, s.Types, ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id, link, tooltip string
+	}{
+		{
+			id:      "users",
+			link:    "./tables/users.html#L3",
+			tooltip: "3 columns, primary key id\nDefined in 1.sql:3\nAltered in 1.sql:15\nColumn m added in 1.sql:15",
+		},
+		{
+			id:      "project_members",
+			link:    "./tables/project_members.html#L6",
+			tooltip: "3 columns\nReferences projects\nDefined in 1.sql:6",
+		},
+		{id: "views.v", link: "./views/v.html#L16", tooltip: "View, 1 column\nDefined in 1.sql:16"},
+		{id: "enums.mood", link: "./types/mood.html#L14", tooltip: "Enum: sad, happy\nDefined in 1.sql:14"},
+	}
+	for _, tt := range tests {
+		obj, ok := g.Root.HasChild(strings.Split(tt.id, "."))
+		if !ok {
+			t.Errorf("no %s in the diagram", tt.id)
+			continue
+		}
+		if obj.Link == nil || obj.Link.Value != tt.link {
+			t.Errorf("%s links to %+v, want %q", tt.id, obj.Link, tt.link)
+		}
+		if obj.Tooltip == nil || obj.Tooltip.Value != tt.tooltip {
+			t.Errorf("%s tooltip %+v, want %q", tt.id, obj.Tooltip, tt.tooltip)
+		}
+	}
+}
+
+func TestRenderD2WithoutDecorations(t *testing.T) {
+	s := parseTestSQL(t, membersSQL)
+	g, err := renderD2(s.Tables, s.FKs, s.Views, s.Types, renderOptions{detail: detailFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range g.Objects {
+		if obj.Link != nil || obj.Tooltip != nil {
+			t.Errorf("%s has a link or tooltip", obj.AbsID())
+		}
+	}
+}
+
+func TestTypeSummary(t *testing.T) {
+	tests := []struct {
+		ct   *CustomType
+		want []string
+	}{
+		{&CustomType{TypeKind: "domain", BaseType: "int4", Check: "value > 0"}, []string{"Domain over int4 CHECK value > 0"}},
+		{&CustomType{TypeKind: "composite", Cols: []Column{{Name: "a"}, {Name: "b"}}}, []string{"Composite type, 2 fields"}},
+	}
+	for _, tt := range tests {
+		if got := typeSummary(tt.ct); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// TestRenderD2Repeatedly renders the same schema in a row and in parallel, as
+// the query diagrams, timeline and diff do within one process. Each render
+// has to create its own views, enums, domains and composites collections.
+func TestRenderD2Repeatedly(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+`
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+CREATE DOMAIN pos AS int CHECK (VALUE > 0);
+CREATE TYPE pair AS (a int, b text);
+CREATE VIEW v AS SELECT id FROM users;
+`)
+	render := func() (string, error) {
+		g, err := renderD2(s.Tables, s.FKs, s.Views, s.Types, renderOptions{detail: detailFull})
+		if err != nil {
+			return "", err
+		}
+		return d2format.Format(g.AST), nil
+	}
+
+	want, err := render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"views", "enums", "domains", "composites"} {
+		if !strings.Contains(want, "\n"+c+": {\n  class: ") {
+			t.Fatalf("the schema should draw the %s collection:\n%s", c, want)
+		}
+	}
+	if got, err := render(); err != nil || got != want {
+		t.Fatalf("the second render differs, error %v:\n%s", err, got)
+	}
+
+	var wg sync.WaitGroup
+	got := make([]string, 8)
+	errs := make([]error, len(got))
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], errs[i] = render()
+		}()
+	}
+	wg.Wait()
+	for i := range got {
+		if errs[i] != nil {
+			t.Errorf("render %d: %v", i, errs[i])
+		} else if got[i] != want {
+			t.Errorf("parallel render %d differs:\n%s", i, got[i])
+		}
+	}
+}
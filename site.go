@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// sitePage is one object of the documentation site.
+type sitePage struct {
+	Kind  string // table, view or the custom type's kind
+	Label string
+	Href  string // relative to the site root
+
+	Columns     []siteColumn
+	Constraints []TableConstraint
+	Outgoing    []siteFK
+	Incoming    []siteFK
+	Type        *CustomType
+	Query       string
+}
+
+type siteColumn struct {
+	Name, Type, Keys string
+	TypeHref         string // page of the column's custom type, if any
+	Ref              *siteLink
+}
+
+type siteFK struct {
+	Cols  []string
+	Other siteLink
+}
+
+type siteLink struct {
+	Label, Href, Cols string
+}
+
+type siteSearchEntry struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Href    string   `json:"href"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+// renderSite writes a static, offline documentation site into dir: an index
+// with the diagram, when there is one, and a searchable list of objects, and a
+// page per table, view and type cross-linking foreign keys and column types.
+func renderSite(s *Schema, svg []byte, dir string) ([]file, error) {
+	tablePages := map[*Table]*sitePage{}
+	typeHrefs := map[string]string{}
+	pageCols := map[*sitePage][]Column{}
+	var pages []*sitePage
+
+	for _, k := range sortedKeys(s.Tables) {
+		t := s.Tables[k]
+		p := &sitePage{Kind: "table", Label: tableLabel(t.Schema, t.Name), Constraints: t.Constraints}
+		p.Href = sitePagePath(p.Kind, p.Label)
+		tablePages[t] = p
+		pageCols[p] = t.Cols
+		pages = append(pages, p)
+	}
+	for _, k := range sortedKeys(s.Views) {
+		v := s.Views[k]
+		p := &sitePage{Kind: "view", Label: tableLabel(v.Schema, v.Name), Query: v.Query}
+		p.Href = sitePagePath(p.Kind, p.Label)
+		pageCols[p] = v.Cols
+		pages = append(pages, p)
+	}
+	for _, k := range sortedKeys(s.Types) {
+		ct := s.Types[k]
+		p := &sitePage{Kind: ct.TypeKind, Label: tableLabel(ct.Schema, ct.Name), Type: ct}
+		p.Href = sitePagePath(p.Kind, p.Label)
+		typeHrefs[p.Label] = p.Href
+		typeHrefs[key(ct.Schema, ct.Name)] = p.Href
+		pageCols[p] = ct.Cols
+		pages = append(pages, p)
+	}
+
+	columns := func(cols []Column) []siteColumn {
+		var out []siteColumn
+		for _, c := range cols {
+			typ := strings.TrimPrefix(c.Type, "pg_catalog.")
+			if typ == "unknown" {
+				typ = ""
+			}
+			sc := siteColumn{Name: c.Name, Type: typ, TypeHref: typeHrefs[strings.TrimSuffix(typ, "[]")]}
+			var keys []string
+			if c.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if c.Unique {
+				keys = append(keys, "UNQ")
+			}
+			if c.ForeignKey != nil {
+				keys = append(keys, "FK")
+			}
+			if c.NotNull && !c.PrimaryKey {
+				keys = append(keys, "NOT NULL")
+			}
+			sc.Keys = strings.Join(keys, " ")
+			if c.ForeignKey != nil {
+				label := tableLabel(c.ForeignKey.DstSchema, c.ForeignKey.DstTable)
+				sc.Ref = &siteLink{Label: label, Cols: strings.Join(c.ForeignKey.DstCols, ", ")}
+				if _, dst := s.lookupTable(c.ForeignKey.DstSchema, c.ForeignKey.DstTable); dst != nil {
+					sc.Ref.Href = tablePages[dst].Href
+				}
+			}
+			out = append(out, sc)
+		}
+		return out
+	}
+
+	for _, p := range pages {
+		p.Columns = columns(pageCols[p])
+	}
+
+	for _, r := range s.relations() {
+		from, to := tablePages[r.From], tablePages[r.To]
+		from.Outgoing = append(from.Outgoing, siteFK{
+			Cols:  r.FromCols,
+			Other: siteLink{Label: to.Label, Href: to.Href, Cols: strings.Join(r.ToCols, ", ")},
+		})
+		to.Incoming = append(to.Incoming, siteFK{
+			Cols:  r.ToCols,
+			Other: siteLink{Label: from.Label, Href: from.Href, Cols: strings.Join(r.FromCols, ", ")},
+		})
+	}
+
+	search := make([]siteSearchEntry, 0, len(pages))
+	for _, p := range pages {
+		e := siteSearchEntry{Kind: p.Kind, Name: p.Label, Href: p.Href}
+		for _, c := range p.Columns {
+			e.Columns = append(e.Columns, c.Name)
+		}
+		search = append(search, e)
+	}
+	searchJSON, err := json.Marshal(search)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode search index: %w", err)
+	}
+
+	var fs []file
+	var buf bytes.Buffer
+	err = siteTemplates.ExecuteTemplate(&buf, "index", map[string]any{
+		"Root":   "",
+		"Title":  "Schema",
+		"SVG":    template.HTML(stripXMLHeader(svg)),
+		"Pages":  pages,
+		"Search": template.JS(searchJSON),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render site index: %w", err)
+	}
+	fs = append(fs, file{path: path.Join(dir, "index.html"), content: buf.String()})
+
+	for _, p := range pages {
+		buf.Reset()
+		err := siteTemplates.ExecuteTemplate(&buf, "page", map[string]any{
+			"Root":  "../",
+			"Title": p.Label,
+			"Page":  p,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render site page %s: %w", p.Label, err)
+		}
+		fs = append(fs, file{path: path.Join(dir, p.Href), content: buf.String()})
+	}
+	return fs, nil
+}
+
+// sitePagePath is an object's page relative to the site root.
+func sitePagePath(kind, label string) string {
+	dir := "types/"
+	switch kind {
+	case "table":
+		dir = "tables/"
+	case "view":
+		dir = "views/"
+	}
+	return dir + strings.NewReplacer("/", "_", `\`, "_").Replace(label) + ".html"
+}
+
+// stripXMLHeader drops the XML declaration so the SVG can be inlined in HTML.
+func stripXMLHeader(svg []byte) string {
+	s := string(svg)
+	if strings.HasPrefix(s, "<?xml") {
+		if i := strings.Index(s, "?>"); i >= 0 {
+			s = s[i+2:]
+		}
+	}
+	return s
+}
+
+var siteTemplates = template.Must(template.New("site").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0 auto; max-width: 72rem; padding: 1rem 2rem; color: #222; }
+a { color: #0b5cad; text-decoration: none; }
+a:hover { text-decoration: underline; }
+table { border-collapse: collapse; margin: 1rem 0; }
+th, td { border: 1px solid #ddd; padding: .3rem .6rem; text-align: left; }
+th { background: #f4f4f4; }
+code { font-family: ui-monospace, monospace; }
+.kind { color: #777; font-size: .8em; text-transform: uppercase; }
+.diagram { overflow: auto; border: 1px solid #ddd; max-height: 80vh; }
+.diagram svg { max-width: none; height: auto; }
+#search { width: 100%; padding: .5rem; font-size: 1rem; box-sizing: border-box; }
+ul.objects { columns: 3; list-style: none; padding: 0; }
+</style>
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">Schema</a></nav>
+{{end}}
+
+{{define "index"}}{{template "head" .}}
+<h1>Schema</h1>
+{{if .SVG}}<div class="diagram">{{.SVG}}</div>{{end}}
+<h2>Objects</h2>
+<input id="search" type="search" placeholder="Search tables, views, types and columns" autocomplete="off">
+<ul class="objects" id="objects">
+{{range .Pages}}<li><a href="{{.Href}}">{{.Label}}</a> <span class="kind">{{.Kind}}</span></li>
+{{end}}</ul>
+<script>
+(function () {
+  var entries = {{.Search}};
+  var list = document.getElementById("objects");
+  document.getElementById("search").addEventListener("input", function (ev) {
+    var q = ev.target.value.trim().toLowerCase();
+    list.innerHTML = "";
+    entries.forEach(function (e) {
+      var cols = (e.columns || []).filter(function (c) { return q && c.toLowerCase().indexOf(q) >= 0; });
+      if (q && e.name.toLowerCase().indexOf(q) < 0 && cols.length === 0) {
+        return;
+      }
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = e.href;
+      a.textContent = e.name;
+      li.appendChild(a);
+      var kind = document.createElement("span");
+      kind.className = "kind";
+      kind.textContent = " " + e.kind + (cols.length ? " · " + cols.join(", ") : "");
+      li.appendChild(kind);
+      list.appendChild(li);
+    });
+  });
+})();
+</script>
+</body>
+</html>
+{{end}}
+
+{{define "page"}}{{template "head" .}}{{with .Page}}
+<h1>{{.Label}} <span class="kind">{{.Kind}}</span></h1>
+{{with .Type}}{{if .BaseType}}<p>Base type <code>{{.BaseType}}</code>{{if .NotNull}}, not null{{end}}{{if .Default}}, default <code>{{.Default}}</code>{{end}}</p>{{end}}
+{{if .Check}}<p>Check <code>{{.Check}}</code></p>{{end}}
+{{if .Values}}<h2>Values</h2><ul>{{range .Values}}<li><code>{{.}}</code></li>{{end}}</ul>{{end}}{{end}}
+{{if .Columns}}<h2>Columns</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>Keys</th><th>References</th></tr>
+{{range .Columns}}<tr><td><code>{{.Name}}</code></td><td>{{if .TypeHref}}<a href="{{$.Root}}{{.TypeHref}}"><code>{{.Type}}</code></a>{{else}}<code>{{.Type}}</code>{{end}}</td><td>{{.Keys}}</td><td>{{with .Ref}}{{if .Href}}<a href="{{$.Root}}{{.Href}}">{{.Label}}</a>{{else}}{{.Label}}{{end}}{{if .Cols}} ({{.Cols}}){{end}}{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Constraints}}<h2>Constraints</h2><ul>{{range .Constraints}}<li><code>{{.Name}}</code> {{.Type}} <code>{{.Description}}</code></li>{{end}}</ul>{{end}}
+{{if .Outgoing}}<h2>References</h2><ul>{{range .Outgoing}}<li>({{range $i, $c := .Cols}}{{if $i}}, {{end}}{{$c}}{{end}}) → <a href="{{$.Root}}{{.Other.Href}}">{{.Other.Label}}</a> ({{.Other.Cols}})</li>{{end}}</ul>{{end}}
+{{if .Incoming}}<h2>Referenced by</h2><ul>{{range .Incoming}}<li><a href="{{$.Root}}{{.Other.Href}}">{{.Other.Label}}</a> ({{.Other.Cols}}) → ({{range $i, $c := .Cols}}{{if $i}}, {{end}}{{$c}}{{end}})</li>{{end}}</ul>{{end}}
+{{if .Query}}<h2>Query</h2><pre><code>{{.Query}}</code></pre>{{end}}
+{{end}}</body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderSite(t *testing.T) {
+	s := parseTestSQL(t, membersSQL+`
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+ALTER TABLE users ADD COLUMN m mood;
+CREATE VIEW v AS SELECT id FROM users;
+`)
+	s.Views["v"].Query = "SELECT id FROM users WHERE id < 10"
+	fs, err := renderSite(s, []byte(`<?xml version="1.0"?><svg></svg>`), "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"site/index.html",
+		"site/tables/audit.html", "site/tables/profiles.html", "site/tables/project_members.html",
+		"site/tables/projects.html", "site/tables/users.html",
+		"site/views/v.html",
+		"site/types/mood.html",
+	}
+	if got := filePaths(fs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got files %q\nwant %q", got, want)
+	}
+	pages := map[string]string{}
+	for _, f := range fs {
+		pages[f.path] = f.content
+	}
+
+	for path, snippets := range map[string][]string{
+		"site/index.html": {
+			`<div class="diagram"><svg></svg></div>`,
+			`<li><a href="tables/users.html">users</a> <span class="kind">table</span></li>`,
+			`{"kind":"table","name":"users","href":"tables/users.html","columns":["id","email","m"]}`,
+			`{"kind":"enum","name":"mood","href":"types/mood.html"}`,
+		},
+		"site/tables/users.html": {
+			`<nav><a href="../index.html">Schema</a></nav>`,
+			`<td><a href="../types/mood.html"><code>mood</code></a></td>`,
+			`<li><a href="../tables/profiles.html">profiles</a> (user_id) → (id)</li>`,
+			`<li><a href="../tables/project_members.html">project_members</a> (user_id) → (id)</li>`,
+		},
+		"site/tables/project_members.html": {
+			`<td><code>project_id</code></td><td><code>int4</code></td><td>FK</td><td><a href="../tables/projects.html">projects</a> (id)</td>`,
+			`<h2>References</h2>`,
+			`(user_id) → <a href="../tables/users.html">users</a> (id)`,
+		},
+		"site/views/v.html": {
+			`<h1>v <span class="kind">view</span></h1>`,
+			"<pre><code>SELECT id FROM users WHERE id &lt; 10</code></pre>",
+		},
+		"site/types/mood.html": {
+			`<li><code>sad</code></li><li><code>happy</code></li>`,
+		},
+	} {
+		for _, snippet := range snippets {
+			if !strings.Contains(pages[path], snippet) {
+				t.Errorf("%s is missing %s", path, snippet)
+			}
+		}
+	}
+}
+
+func TestRenderSiteWithoutDiagram(t *testing.T) {
+	fs, err := renderSite(parseTestSQL(t, membersSQL), nil, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs[0].path != "docs/index.html" || strings.Contains(fs[0].content, `class="diagram"`) {
+		t.Errorf("index %s should have no diagram:\n%s", fs[0].path, fs[0].content)
+	}
+}
+
+func TestSitePagePath(t *testing.T) {
+	for _, tt := range []struct{ kind, label, want string }{
+		{"table", "users", "tables/users.html"},
+		{"view", "audit.recent", "views/audit.recent.html"},
+		{"domain", `a/b\c`, "types/a_b_c.html"},
+	} {
+		if got := sitePagePath(tt.kind, tt.label); got != tt.want {
+			t.Errorf("sitePagePath(%q, %q) = %q, want %q", tt.kind, tt.label, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+-- name: ListPostsByUser :many
+select p.id, p.title, p.posted_at, u.username
+from posts p
+join users u on u.id = p.user_id
+where u.id = $1
+order by p.posted_at desc;
+
+-- name: CreatePost :one
+insert into posts (user_id, title, body)
+values ($1, $2, $3)
+returning *;
+
+-- name: ListPostComments :many
+select c.author, c.body, c.created_at
+from comments c
+join posts p on p.id = c.post_id
+where p.id = $1;
+
+-- name: DeletePost :exec
+delete from posts where id = $1;
+
+-- name: ListUserComments :many
+SELECT c.* FROM comments c
+JOIN users u ON u.username = c.author
+WHERE u.id = $1;
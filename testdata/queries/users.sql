@@ -0,0 +1,16 @@
+-- name: GetUser :one
+select * from users
+where id = $1;
+
+-- name: GetUserByEmail :one
+select id, username, email from users
+where email = @email;
+
+-- name: CreateUser :one
+insert into users (username, email)
+values ($1, $2)
+returning id;
+
+-- name: UpdateUserMood :exec
+update users set mood = sqlc.arg(mood)
+where id = sqlc.arg(id);
@@ -0,0 +1,125 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2renderers/d2animate"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// timelineInterval is how long each migration is shown for, in milliseconds.
+const timelineInterval = 2500
+
+// timelineTitle is the key of the text naming a board's migration. SQL names
+// rarely have a dash in them, so it shouldn't clash with a table.
+const timelineTitle = "timeline-migration"
+
+// renderTimeline replays the migrations one file at a time and renders the
+// schema after each as a D2 step, colouring what the file added and changed,
+// then animates the steps into one SVG.
+func renderTimeline(ctx context.Context, s *Schema, opts Options) ([]file, error) {
+	if opts.Outputs.Timeline == "" {
+		return nil, nil
+	}
+	if len(s.Files) == 0 {
+		return nil, fmt.Errorf("the timeline output needs migration files")
+	}
+
+	src, err := timelineD2(s, opts)
+	if err != nil {
+		return nil, err
+	}
+	diagram, themeID, err := layoutDiagram(ctx, src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the boards share the root's styles, like the d2 CLI's --animate-interval
+	masterID, err := diagram.HashID(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash timeline: %w", err)
+	}
+	pad := int64(d2svg.DEFAULT_PADDING)
+	ro := d2svg.RenderOpts{ThemeID: &themeID, Pad: &pad, MasterID: masterID}
+	var boards [][]byte
+	for _, d := range append([]*d2target.Diagram{diagram}, diagram.Steps...) {
+		svg, err := d2svg.Render(d, &ro)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render timeline step: %w", err)
+		}
+		boards = append(boards, svg)
+	}
+	svg, err := d2animate.Wrap(diagram, boards, ro, timelineInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to animate timeline: %w", err)
+	}
+	svg = stampSVG(svg, src, opts.Theme, opts.Layout, strconv.Itoa(timelineInterval))
+	return []file{{path: opts.Outputs.Timeline, content: string(svg)}}, nil
+}
+
+// timelineD2 is the D2 source of the timeline: the first migration on the
+// root board and every later one as a step. Steps inherit the board before
+// them, so each starts by deleting everything the last one drew.
+func timelineD2(s *Schema, opts Options) (string, error) {
+	var sb strings.Builder
+	cur := newSchema(s.Engine)
+	prev := newSchema(s.Engine)
+	var drawn []string
+	for i, path := range s.Files {
+		if err := parseFile(cur, path, os.ReadFile); err != nil {
+			return "", err
+		}
+		step := cloneSchema(cur)
+		opts.applyFilters(step)
+
+		ro := renderOptions{detail: opts.Detail, diff: diffSchemas(prev, step)}
+		g, err := renderD2(step.Tables, step.FKs, step.Views, step.Types, ro)
+		if err != nil {
+			return "", fmt.Errorf("failed to render d2 after %s: %s", path, err)
+		}
+
+		switch i {
+		case 0:
+		case 1:
+			sb.WriteString("steps: {\n")
+			fallthrough
+		default:
+			fmt.Fprintf(&sb, "%d: {\n", i+1)
+			for _, id := range drawn {
+				fmt.Fprintf(&sb, "%s: null\n", id)
+			}
+		}
+		sb.WriteString(d2format.Format(g.AST))
+		fmt.Fprintf(&sb, "\n%s: %s {\n  shape: text\n  near: top-center\n  style.font-size: 28\n}\n", timelineTitle, strconv.Quote(filepath.Base(path)))
+		if i > 0 {
+			sb.WriteString("}\n")
+		}
+
+		drawn = topLevelKeys(g)
+		prev = step
+	}
+	if len(s.Files) > 1 {
+		sb.WriteString("}\n")
+	}
+	return sb.String(), nil
+}
+
+// topLevelKeys are the D2 keys of the graph's root objects.
+func topLevelKeys(g *d2graph.Graph) []string {
+	var keys []string
+	for _, obj := range g.Root.ChildrenArray {
+		keys = append(keys, d2format.Format(d2ast.MakeKeyPath([]string{obj.IDVal})))
+	}
+	return keys
+}
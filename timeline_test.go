@@ -0,0 +1,108 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// writeMigrations writes the migrations into a temporary directory as 001.sql,
+// 002.sql, ... and parses them.
+func writeMigrations(t *testing.T, migrations ...string) *Schema {
+	t.Helper()
+	dir := t.TempDir()
+	var files []string
+	for i, sql := range migrations {
+		p := filepath.Join(dir, fmt.Sprintf("%03d.sql", i+1))
+		if err := os.WriteFile(p, []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, p)
+	}
+	s, err := parseMigrations(files, enginePostgreSQL, "", os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestTimelineD2(t *testing.T) {
+	s := writeMigrations(t,
+		"CREATE TABLE users (id int PRIMARY KEY);",
+		"CREATE TABLE posts (id int, user_id int REFERENCES users(id));",
+		"DROP TABLE posts; CREATE VIEW v AS SELECT id FROM users;",
+	)
+	src, err := timelineD2(s, defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _, err := d2compiler.Compile("", strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatalf("compiling:\n%s\n%v", src, err)
+	}
+	if len(g.Steps) != 2 {
+		t.Fatalf("got %d steps, want one per migration after the first", len(g.Steps))
+	}
+
+	want := []struct {
+		title   string
+		objects []string
+	}{
+		{"001.sql", []string{"timeline-migration", "users"}},
+		{"002.sql", []string{"posts", "timeline-migration", "users"}},
+		{"003.sql", []string{"timeline-migration", "users", "views"}},
+	}
+	for i, board := range append([]*d2graph.Graph{g}, g.Steps...) {
+		var got []string
+		for _, obj := range board.Root.ChildrenArray {
+			got = append(got, obj.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want[i].objects) {
+			t.Errorf("board %d draws %q, want %q", i, got, want[i].objects)
+		}
+		title, ok := board.Root.HasChild([]string{timelineTitle})
+		if !ok || title.Label.Value != want[i].title {
+			t.Errorf("board %d has title %v, want %q", i, title, want[i].title)
+		}
+	}
+}
+
+func TestRenderTimeline(t *testing.T) {
+	s := writeMigrations(t,
+		"CREATE TABLE users (id int PRIMARY KEY);",
+		"ALTER TABLE users ADD COLUMN email text;",
+	)
+	opts := defaultOptions()
+	opts.Layout = "dagre"
+	opts.Outputs.Timeline = "timeline.svg"
+	fs, err := renderTimeline(context.Background(), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs) != 1 || fs[0].path != "timeline.svg" {
+		t.Fatalf("got files %q, want timeline.svg", filePaths(fs))
+	}
+	if svg := fs[0].content; !strings.Contains(svg, "@keyframes") || !strings.Contains(svg, "002.sql") {
+		t.Errorf("not an animated timeline through 002.sql: %.200s", svg)
+	}
+
+	opts.Outputs.Timeline = ""
+	if fs, err := renderTimeline(context.Background(), s, opts); err != nil || fs != nil {
+		t.Errorf("disabled timeline gave %q, %v", filePaths(fs), err)
+	}
+
+	opts.Outputs.Timeline = "timeline.svg"
+	if _, err := renderTimeline(context.Background(), parseTestSQL(t, membersSQL), opts); err == nil {
+		t.Error("a schema without migration files should have no timeline")
+	}
+}
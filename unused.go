@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unusedReport lists the tables and columns no query references. Columns are
+// only listed for tables that are used, an unused table implies all of its
+// columns are.
+type unusedReport struct {
+	Queries int             `json:"queries"`
+	Tables  []string        `json:"tables"`
+	Columns []unusedColumns `json:"columns"`
+}
+
+type unusedColumns struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// findUnused works out what the queries don't reference. Reading a view
+// counts as reading whatever its query reads.
+func findUnused(s *Schema, usage []*queryUsage) *unusedReport {
+	referenced := map[string]map[string]bool{}
+	seen := map[string]bool{}
+	for _, u := range usage {
+		ms := []map[string]map[string]bool{u.Reads, u.Writes}
+		for k := range u.Views {
+			ms = append(ms, s.viewReads(k, seen))
+		}
+		for _, m := range ms {
+			for k, cols := range m {
+				if referenced[k] == nil {
+					referenced[k] = map[string]bool{}
+				}
+				for c := range cols {
+					referenced[k][c] = true
+				}
+			}
+		}
+	}
+
+	ks := make([]string, 0, len(s.Tables))
+	for k := range s.Tables {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	r := &unusedReport{Queries: len(usage), Tables: []string{}, Columns: []unusedColumns{}}
+	for _, k := range ks {
+		t := s.Tables[k]
+		cols, ok := referenced[k]
+		if !ok {
+			r.Tables = append(r.Tables, tableLabel(t.Schema, t.Name))
+			continue
+		}
+		uc := unusedColumns{Table: tableLabel(t.Schema, t.Name)}
+		for _, c := range t.Cols {
+			if !cols[c.Name] {
+				uc.Columns = append(uc.Columns, c.Name)
+			}
+		}
+		if len(uc.Columns) > 0 {
+			r.Columns = append(r.Columns, uc)
+		}
+	}
+	return r
+}
+
+// table reports whether the table with the given label is unused.
+func (r *unusedReport) table(label string) bool {
+	for _, t := range r.Tables {
+		if t == label {
+			return true
+		}
+	}
+	return false
+}
+
+// columns returns the unused columns of a used table.
+func (r *unusedReport) columns(label string) map[string]bool {
+	out := map[string]bool{}
+	for _, uc := range r.Columns {
+		if uc.Table == label {
+			for _, c := range uc.Columns {
+				out[c] = true
+			}
+		}
+	}
+	return out
+}
+
+func (r *unusedReport) json() (string, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode unused report: %w", err)
+	}
+	return string(b) + "\n", nil
+}
+
+func (r *unusedReport) markdown() string {
+	var sb strings.Builder
+	sb.WriteString("# Unused schema objects\n\n")
+	fmt.Fprintf(&sb, "Tables and columns none of the %s reference, directly or through a view.\n", plural(r.Queries, "query"))
+
+	sb.WriteString("\n## Tables\n\n")
+	if len(r.Tables) == 0 {
+		sb.WriteString("Every table is used.\n")
+	}
+	for _, t := range r.Tables {
+		fmt.Fprintf(&sb, "- `%s`\n", t)
+	}
+
+	sb.WriteString("\n## Columns\n\n")
+	if len(r.Columns) == 0 {
+		sb.WriteString("Every column of the used tables is referenced.\n")
+		return sb.String()
+	}
+	sb.WriteString("| Table | Column |\n|---|---|\n")
+	for _, uc := range r.Columns {
+		for _, c := range uc.Columns {
+			fmt.Fprintf(&sb, "| `%s` | `%s` |\n", uc.Table, c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+func TestFindUnused(t *testing.T) {
+	s := blogSchema(enginePostgreSQL)
+	u := newQueryUsage("GetUser")
+	u.read("users", "id", "username")
+	d := newQueryUsage("DeletePost")
+	d.write("posts")
+	d.read("posts", "id")
+
+	r := findUnused(s, []*queryUsage{u, d})
+	want := &unusedReport{
+		Queries: 2,
+		Tables:  []string{"comments"},
+		Columns: []unusedColumns{
+			{Table: "posts", Columns: []string{"user_id", "title", "body"}},
+			{Table: "users", Columns: []string{"email", "mood"}},
+		},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("got  %+v\nwant %+v", r, want)
+	}
+
+	if !r.table("comments") || r.table("users") {
+		t.Error("only comments should be an unused table")
+	}
+	if got := r.columns("users"); !reflect.DeepEqual(got, map[string]bool{"email": true, "mood": true}) {
+		t.Errorf("unused users columns %v", got)
+	}
+
+	md := r.markdown()
+	for _, line := range []string{"none of the 2 queries reference", "- `comments`", "| `users` | `mood` |"} {
+		if !strings.Contains(md, line) {
+			t.Errorf("markdown is missing %q:\n%s", line, md)
+		}
+	}
+	js, err := r.json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(js, `"tables": [`+"\n"+`    "comments"`) {
+		t.Errorf("unexpected json:\n%s", js)
+	}
+}
+
+func TestFindUnusedEverythingUsed(t *testing.T) {
+	s := testSchema(enginePostgreSQL, map[string][]string{"users": {"id"}})
+	u := newQueryUsage("GetUser")
+	u.read("users", "id")
+
+	r := findUnused(s, []*queryUsage{u})
+	if len(r.Tables) != 0 || len(r.Columns) != 0 {
+		t.Fatalf("got %+v", r)
+	}
+	js, err := r.json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// empty lists rather than null, for tools reading the report
+	if !strings.Contains(js, `"tables": []`) || !strings.Contains(js, `"columns": []`) {
+		t.Errorf("unexpected json:\n%s", js)
+	}
+	if md := r.markdown(); !strings.Contains(md, "Every table is used.") || !strings.Contains(md, "Every column of the used tables is referenced.") {
+		t.Errorf("unexpected markdown:\n%s", md)
+	}
+}
+
+func TestFindUnusedThroughViews(t *testing.T) {
+	tests := []struct {
+		engine      string
+		unusedPosts []string
+	}{
+		{engine: enginePostgreSQL, unusedPosts: []string{"id", "body"}},
+		// without pg_query any column the view names counts, here u.id
+		{engine: engineMySQL, unusedPosts: []string{"body"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			s := blogSchema(tt.engine)
+			s.Views["post_titles"] = &View{Name: "post_titles", Query: "SELECT p.title, u.username FROM posts p JOIN users u ON u.id = p.user_id"}
+			s.Views["titles"] = &View{Name: "titles", Query: "SELECT title FROM post_titles"}
+			q := &pb.Query{
+				Name:    "ListTitles",
+				Text:    "SELECT title FROM titles",
+				Columns: []*pb.Column{{Name: "title", Table: &pb.Identifier{Name: "titles"}}},
+			}
+
+			r := findUnused(s, analyzeQueries(s, []*pb.Query{q}))
+			want := &unusedReport{
+				Queries: 1,
+				Tables:  []string{"comments"},
+				Columns: []unusedColumns{
+					{Table: "posts", Columns: tt.unusedPosts},
+					{Table: "users", Columns: []string{"email", "mood"}},
+				},
+			}
+			if !reflect.DeepEqual(r, want) {
+				t.Fatalf("got  %+v\nwant %+v", r, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	d2log "oss.terrastruct.com/d2/lib/log"
+)
+
+// watchInterval is how often --watch looks for changed files.
+const watchInterval = 500 * time.Millisecond
+
+// runWatch writes the files like runLocal, then again every time a migration,
+// query or model file changes, until interrupted. With --serve it also serves
+// the latest SVG on a page that reloads it as it changes.
+func runWatch(dir string, rawOpts []byte) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ctx = d2log.With(ctx, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+
+	opts, err := localOptions(rawOpts)
+	if err != nil {
+		return err
+	}
+
+	var p *preview
+	if *serve != "" {
+		if opts.Outputs.SVG == "" {
+			return fmt.Errorf("--serve needs the svg output")
+		}
+		ln, err := net.Listen("tcp", *serve)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", *serve, err)
+		}
+		p = &preview{path: opts.Outputs.SVG, clients: map[chan struct{}]bool{}}
+		srv := &http.Server{Handler: p}
+		go srv.Serve(ln)
+		defer srv.Close()
+		fmt.Printf("serving the diagram on http://%s\n", previewHost(ln.Addr().String()))
+	}
+
+	var watched, outputs []string
+	for _, path := range append([]string{dir, *modelPath}, *queryPaths...) {
+		if path != "" {
+			watched = append(watched, path)
+		}
+	}
+	for _, name := range opts.Outputs.names() {
+		if name != "" {
+			outputs = append(outputs, name)
+		}
+	}
+
+	var last map[string]fileStamp
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		if cur := stampFiles(watched, outputs); !maps.Equal(cur, last) {
+			last = cur
+			files, err := localFiles(ctx, dir, opts)
+			if err == nil {
+				err = writeFiles(files)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed: %s\n", err.Error())
+			} else {
+				fmt.Printf("wrote %s at %s\n", plural(len(files), "file"), time.Now().Format(time.TimeOnly))
+			}
+			p.update(files, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fileStamp is what tells a file changed without reading it.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// stampFiles stamps the paths given as files and the .sql files under the
+// ones that are directories, skipping the outputs so writing them doesn't
+// count as a change. Files that come and go change the map too.
+func stampFiles(paths, outputs []string) map[string]fileStamp {
+	skip := map[string]bool{}
+	for _, o := range outputs {
+		if abs, err := filepath.Abs(o); err == nil {
+			skip[abs] = true
+		}
+	}
+	stamps := map[string]fileStamp{}
+	for _, p := range paths {
+		_ = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || path != p && !strings.EqualFold(filepath.Ext(path), ".sql") {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return stamps
+}
+
+// previewHost makes a listener's address something to paste in a browser.
+func previewHost(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// preview serves the latest SVG and tells the pages showing it, over
+// server-sent events, when to fetch it again.
+type preview struct {
+	path string // the SVG output to serve
+
+	mu      sync.Mutex
+	svg     []byte
+	err     error // from the last run, the SVG is from the last good one
+	clients map[chan struct{}]bool
+}
+
+// update keeps the SVG from a run's files, or its error, and tells every page.
+// It's a no-op on nil, when not serving.
+func (p *preview) update(files []file, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	for _, f := range files {
+		if f.path == p.path {
+			p.svg = []byte(f.content)
+		}
+	}
+	for c := range p.clients {
+		select {
+		case c <- struct{}{}:
+		default: // already has one waiting
+		}
+	}
+}
+
+func (p *preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, previewPage)
+	case "/diagram.svg":
+		p.mu.Lock()
+		svg, err := p.svg, p.err
+		p.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(svg)
+	case "/events":
+		p.events(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// events streams a message every time the SVG changes, and one to start
+// with so a page that reconnects catches up.
+func (p *preview) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	c := make(chan struct{}, 1)
+	c <- struct{}{}
+	p.mu.Lock()
+	p.clients[c] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, c)
+		p.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c:
+			if _, err := fmt.Fprint(w, "data: reload\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+var previewPage = strings.TrimSpace(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Schema preview</title>
+<style>
+body { margin: 0; font-family: system-ui, sans-serif; }
+#error { display: none; margin: 0; padding: 1em; background: #fdecea; color: #c62828; white-space: pre-wrap; }
+#diagram svg { max-width: none; height: auto; }
+</style>
+</head>
+<body>
+<pre id="error"></pre>
+<div id="diagram"></div>
+<script>
+const error = document.getElementById("error");
+async function reload() {
+	const res = await fetch("diagram.svg", {cache: "no-store"});
+	const text = await res.text();
+	if (!res.ok) {
+		// keep showing the last good diagram under the error
+		error.textContent = text;
+		error.style.display = "block";
+		return;
+	}
+	error.style.display = "none";
+	document.getElementById("diagram").innerHTML = text;
+}
+new EventSource("events").onmessage = reload;
+</script>
+</body>
+</html>
+`)
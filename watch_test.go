@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStampFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) string {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	mig := write("db/1.sql")
+	upper := write("db/nested/2.SQL")
+	write("db/README.md")
+	write("db/.1.sql.swp")
+	write("db/schema.d2")
+	write("db/site/index.html")
+	write("db/queries/q.sql")
+	model := write("model.json")
+
+	// outputs are relative to the working directory
+	t.Chdir(dir)
+	outputs := []string{"db/schema.d2", "db/site", "db/queries"}
+	stamps := stampFiles([]string{filepath.Join(dir, "db"), model}, outputs)
+
+	got := slices.Sorted(maps.Keys(stamps))
+	want := []string{mig, upper, model}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("stamped %q\nwant %q", got, want)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(mig, later, later); err != nil {
+		t.Fatal(err)
+	}
+	again := stampFiles([]string{filepath.Join(dir, "db"), model}, outputs)
+	if again[mig] == stamps[mig] || again[upper] != stamps[upper] || again[model] != stamps[model] {
+		t.Errorf("got %v after touching %s, was %v", again, mig, stamps)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	p := &preview{path: "schema.svg", clients: map[chan struct{}]bool{}}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, string(b)
+	}
+	if code, page := get("/"); code != http.StatusOK || !strings.Contains(page, `<pre id="error">`) || !strings.Contains(page, `new EventSource("events")`) {
+		t.Fatalf("page %d:\n%s", code, page)
+	}
+
+	res, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("events content type %q", ct)
+	}
+	events := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			if line := sc.Text(); line != "" {
+				events <- line
+			}
+		}
+		close(events)
+	}()
+	next := func(after string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e != "data: reload" {
+				t.Fatalf("got event %q after %s", e, after)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event after %s", after)
+		}
+	}
+	next("connecting")
+
+	p.update([]file{{path: "schema.d2", content: "a"}, {path: "schema.svg", content: "<svg>1</svg>"}}, nil)
+	next("an update")
+	if code, svg := get("/diagram.svg"); code != http.StatusOK || svg != "<svg>1</svg>" {
+		t.Errorf("diagram %d %q, want the updated SVG", code, svg)
+	}
+
+	p.update(nil, errors.New("failed to parse SQL in 2.sql"))
+	next("an error")
+	if code, body := get("/diagram.svg"); code != http.StatusInternalServerError || !strings.Contains(body, "failed to parse SQL in 2.sql") {
+		t.Errorf("diagram %d %q, want the error for the page's banner", code, body)
+	}
+
+	p.update([]file{{path: "schema.d2", content: "b"}}, nil)
+	next("recovering")
+	if code, svg := get("/diagram.svg"); code != http.StatusOK || svg != "<svg>1</svg>" {
+		t.Errorf("diagram %d %q, want the last good SVG", code, svg)
+	}
+}